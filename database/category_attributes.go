@@ -0,0 +1,62 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/Kousuke-irie/hackathon-backend/models"
+	"gorm.io/gorm"
+)
+
+// colorValues 色の選択肢 (各カテゴリで共通)
+var colorValues = []string{
+	"ブラック", "ホワイト", "グレー", "ブラウン", "ベージュ", "レッド", "ピンク", "オレンジ",
+	"イエロー", "グリーン", "ブルー", "ネイビー", "パープル", "シルバー", "ゴールド", "マルチカラー", "その他",
+}
+
+// seedCategoryAttributes カテゴリごとの属性定義の初期データを登録する
+// parentIDs は SeedData のトップレベルカテゴリの番号 (1〜16) から実際のIDへの対応
+func seedCategoryAttributes(db *gorm.DB, parentIDs map[int]uint) error {
+	brand := models.CategoryAttribute{Name: "brand", Label: "ブランド", Type: models.AttributeTypeText, Position: 1}
+	color := models.CategoryAttribute{Name: "color", Label: "色", Type: models.AttributeTypeEnum, AllowedValues: colorValues, Position: 2}
+	clothingSize := models.CategoryAttribute{Name: "size", Label: "サイズ", Type: models.AttributeTypeEnum,
+		AllowedValues: []string{"XS", "S", "M", "L", "XL", "XXL", "FREE"}, Required: true, Position: 3}
+	shoeSize := models.CategoryAttribute{Name: "size", Label: "サイズ", Type: models.AttributeTypeNumber, Unit: "cm", Required: true, Position: 3}
+	capacity := models.CategoryAttribute{Name: "capacity", Label: "容量", Type: models.AttributeTypeEnum,
+		AllowedValues: []string{"32GB", "64GB", "128GB", "256GB", "512GB", "1TB", "2TB"}, Required: true, Position: 3}
+
+	definitions := []struct {
+		Parent     int    // トップレベルカテゴリの番号
+		Sub        string // 空の場合はトップレベルカテゴリ自体に定義する
+		Attributes []models.CategoryAttribute
+	}{
+		{Parent: 1, Attributes: []models.CategoryAttribute{brand, color, clothingSize}},
+		{Parent: 1, Sub: "レディース 靴", Attributes: []models.CategoryAttribute{shoeSize}},
+		{Parent: 2, Attributes: []models.CategoryAttribute{brand, color, clothingSize}},
+		{Parent: 2, Sub: "メンズ 靴", Attributes: []models.CategoryAttribute{shoeSize}},
+		{Parent: 5, Attributes: []models.CategoryAttribute{brand, color}},
+		{Parent: 5, Sub: "スマホ本体", Attributes: []models.CategoryAttribute{capacity}},
+		{Parent: 5, Sub: "パソコン", Attributes: []models.CategoryAttribute{capacity}},
+		{Parent: 13, Attributes: []models.CategoryAttribute{brand, color}},
+	}
+
+	for _, def := range definitions {
+		categoryID := parentIDs[def.Parent]
+		if def.Sub != "" {
+			var sub models.Category
+			// サブカテゴリ名は親をまたいで重複するため、親カテゴリと合わせて特定する
+			if err := db.Where("name = ? AND parent_id = ?", def.Sub, categoryID).First(&sub).Error; err != nil {
+				return fmt.Errorf("category %q not found: %w", def.Sub, err)
+			}
+			categoryID = sub.ID
+		}
+
+		for _, attr := range def.Attributes {
+			attr.CategoryID = categoryID
+			if err := db.Where(models.CategoryAttribute{CategoryID: categoryID, Name: attr.Name}).
+				FirstOrCreate(&attr).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -17,6 +17,10 @@ var DBClient *gorm.DB
 
 // InitDB データベース接続とマイグレーションを実行
 func InitDB() error {
+	if err := InitEncryption(); err != nil {
+		return fmt.Errorf("failed to initialize field encryption: %w", err)
+	}
+
 	var dsn string
 
 	dbUser := os.Getenv("DB_USER")
@@ -48,7 +52,9 @@ func InitDB() error {
 	}
 
 	var err error
-	DBClient, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	DBClient, err = gorm.Open(mysql.Open(dsn), &gorm.Config{
+		TranslateError: true, // 一意制約違反などを gorm.ErrDuplicatedKey などに変換する
+	})
 	if err != nil {
 		return fmt.Errorf("failed to connect database: %w", err)
 	}
@@ -56,28 +62,50 @@ func InitDB() error {
 	// ▼▼▼ 【修正点1】マイグレーション前に外部キーチェックを無効化し、エラーを回避 ▼▼▼
 	DBClient.Exec("SET FOREIGN_KEY_CHECKS = 0;")
 
-	err = DBClient.Migrator().DropTable(
-		&models.Review{},
-		&models.Transaction{},
-		&models.Like{},
-		&models.Comment{},
-		&models.CommunityPost{},
-		&models.Community{},
-		&models.Item{},
-		&models.User{},
-		&models.Category{},
-		&models.ProductCondition{},
-		&models.Notification{},
-		&models.Follow{},
-		&models.ViewHistory{},
-		&models.Message{},
-	)
-
-	if err != nil {
-		// ここでエラーハンドリングを行います
-		log.Printf("テーブルの削除中にエラーが発生しました: %v\n", err)
-		// 必要に応じて、エラーを呼び出し元に返すか、アプリケーションを終了するなど、適切な対応を行います
-		return err
+	// 💡 MIGRATE_ITEM_IMAGES=true で起動したときはテーブルを削除せず、既存商品の image_url を item_images に移行する (一度だけ実行する移行用)
+	migrateItemImages := os.Getenv("MIGRATE_ITEM_IMAGES") == "true"
+	if !migrateItemImages {
+		err = DBClient.Migrator().DropTable(
+			&models.Review{},
+			&models.Transaction{},
+			&models.Like{},
+			&models.Comment{},
+			&models.CommunityPost{},
+			&models.Community{},
+			&models.Item{},
+			&models.User{},
+			&models.Category{},
+			&models.ProductCondition{},
+			&models.Notification{},
+			&models.Follow{},
+			&models.ViewHistory{},
+			&models.Message{},
+			&models.Session{},
+			&models.UserIdentity{},
+			&models.AccountAuditLog{},
+			&models.UserBlock{},
+			&models.Address{},
+			&models.SellerVerification{},
+			&models.ItemImage{},
+			&models.ItemPriceHistory{},
+			&models.ItemRevision{},
+			&models.CategoryAttribute{},
+			&models.ItemAttribute{},
+			&models.Order{},
+			&models.ShippingRule{},
+			&models.Offer{},
+			&models.Auction{},
+			&models.Bid{},
+			&models.ItemDailyStat{},
+			&models.StockHold{},
+		)
+
+		if err != nil {
+			// ここでエラーハンドリングを行います
+			log.Printf("テーブルの削除中にエラーが発生しました: %v\n", err)
+			// 必要に応じて、エラーを呼び出し元に返すか、アプリケーションを終了するなど、適切な対応を行います
+			return err
+		}
 	}
 
 	// マイグレーション
@@ -86,6 +114,22 @@ func InitDB() error {
 		&models.Like{}, &models.Comment{}, &models.Community{}, &models.CommunityPost{},
 		&models.Category{}, &models.ProductCondition{}, &models.Review{}, &models.Notification{},
 		&models.Follow{}, &models.ViewHistory{}, &models.Message{},
+		&models.Session{}, &models.UserIdentity{}, &models.AccountAuditLog{},
+		&models.UserBlock{},
+		&models.Address{},
+		&models.SellerVerification{},
+		&models.ItemImage{},
+		&models.ItemPriceHistory{},
+		&models.ItemRevision{},
+		&models.CategoryAttribute{},
+		&models.ItemAttribute{},
+		&models.Order{},
+		&models.ShippingRule{},
+		&models.Offer{},
+		&models.Auction{},
+		&models.Bid{},
+		&models.ItemDailyStat{},
+		&models.StockHold{},
 	)
 
 	// ▼▼▼ 【修正点2】マイグレーション後に外部キーチェックを有効に戻す ▼▼▼
@@ -94,6 +138,11 @@ func InitDB() error {
 	if err != nil {
 		return fmt.Errorf("failed to migrate database: %w", err)
 	}
+	if migrateItemImages {
+		if err := MigrateItemImages(DBClient); err != nil {
+			return fmt.Errorf("failed to migrate item images: %w", err)
+		}
+	}
 	fmt.Println("Database migration completed!")
 
 	if err := SeedData(DBClient); err != nil {
@@ -119,6 +168,11 @@ func SeedData(db *gorm.DB) error {
 		return fmt.Errorf("failed to truncate product_conditions: %w", err)
 	}
 
+	if err := db.Exec("TRUNCATE TABLE `category_attributes`;").Error; err != nil {
+		db.Exec("SET FOREIGN_KEY_CHECKS = 1;")
+		return fmt.Errorf("failed to truncate category_attributes: %w", err)
+	}
+
 	// 3. 外部キーチェックをオンに戻す
 	db.Exec("SET FOREIGN_KEY_CHECKS = 1;")
 
@@ -301,6 +355,10 @@ func SeedData(db *gorm.DB) error {
 		}
 	}
 
+	if err := seedCategoryAttributes(db, parentIDs); err != nil {
+		return fmt.Errorf("failed to seed category attributes: %w", err)
+	}
+
 	// 商品状態の初期データ
 	conditions := []models.ProductCondition{
 		{Name: "新品、未使用", Rank: 1},
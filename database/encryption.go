@@ -0,0 +1,124 @@
+package database
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm/schema"
+)
+
+// encryptedPrefix 暗号化済みの値に付ける接頭辞 (暗号化前に保存された平文と区別する)
+const encryptedPrefix = "enc:v1:"
+
+var fieldCipher cipher.AEAD
+
+func init() {
+	// `gorm:"serializer:encrypted"` を付けたフィールドは AES-GCM で暗号化して保存する
+	schema.RegisterSerializer("encrypted", EncryptedSerializer{})
+}
+
+// InitEncryption FIELD_ENCRYPTION_KEY から列暗号化用の鍵を作成する
+// AUTH_PROVIDER=local の場合のみ、未設定でも開発用の鍵で起動できる
+func InitEncryption() error {
+	key := os.Getenv("FIELD_ENCRYPTION_KEY")
+	if key == "" {
+		if strings.ToLower(os.Getenv("AUTH_PROVIDER")) != "local" {
+			return errors.New("FIELD_ENCRYPTION_KEY is not set")
+		}
+		log.Println("WARNING: FIELD_ENCRYPTION_KEY is not set. Using the built-in development key.")
+		key = "local-field-encryption-key"
+	}
+
+	// 任意長の設定値から AES-256 の鍵を導出する
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return fmt.Errorf("failed to create cipher: %w", err)
+	}
+	fieldCipher, err = cipher.NewGCM(block)
+	if err != nil {
+		return fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return nil
+}
+
+// EncryptedSerializer 文字列フィールドを暗号化して保存し、読み込み時に復号する
+type EncryptedSerializer struct{}
+
+// Scan implements serializer interface
+func (EncryptedSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var stored string
+	switch v := dbValue.(type) {
+	case nil:
+	case []byte:
+		stored = string(v)
+	case string:
+		stored = v
+	default:
+		return fmt.Errorf("unsupported encrypted value type: %T", dbValue)
+	}
+
+	plain, err := decryptField(stored)
+	if err != nil {
+		return err
+	}
+	field.ReflectValueOf(ctx, dst).SetString(plain)
+	return nil
+}
+
+// Value implements serializer interface
+func (EncryptedSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	plain, _ := fieldValue.(string)
+	return encryptField(plain)
+}
+
+func encryptField(plain string) (string, error) {
+	if plain == "" {
+		return "", nil
+	}
+	if fieldCipher == nil {
+		return "", errors.New("field encryption is not initialized")
+	}
+
+	nonce := make([]byte, fieldCipher.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := fieldCipher.Seal(nonce, nonce, []byte(plain), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decryptField(stored string) (string, error) {
+	encoded, ok := strings.CutPrefix(stored, encryptedPrefix)
+	if !ok {
+		// 暗号化導入前の平文はそのまま返す (次回保存時に暗号化される)
+		return stored, nil
+	}
+	if fieldCipher == nil {
+		return "", errors.New("field encryption is not initialized")
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode encrypted field: %w", err)
+	}
+	nonceSize := fieldCipher.NonceSize()
+	if len(sealed) < nonceSize {
+		return "", errors.New("encrypted field is too short")
+	}
+	plain, err := fieldCipher.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt field: %w", err)
+	}
+	return string(plain), nil
+}
@@ -0,0 +1,51 @@
+package database
+
+import (
+	"log"
+
+	"github.com/Kousuke-irie/hackathon-backend/models"
+	"gorm.io/gorm"
+)
+
+// MigrateItemImages items.image_url に JSON 配列で保存されていた画像を item_images テーブルに移す
+// item_images を持たない商品だけを対象にするため、何度実行しても結果は変わらない
+func MigrateItemImages(db *gorm.DB) error {
+	var items []models.Item
+	err := db.Select("id, image_url").
+		Where("image_url <> '' AND image_url <> '[]'").
+		Where("id NOT IN (?)", db.Model(&models.ItemImage{}).Select("item_id")).
+		Find(&items).Error
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		urls := models.SplitImageURLs(item.ImageURL)
+		if len(urls) == 0 {
+			log.Printf("WARNING: item %d has an unparsable image_url, skipped", item.ID)
+			continue
+		}
+		if len(urls) > models.MaxItemImages {
+			urls = urls[:models.MaxItemImages]
+		}
+
+		images := make([]models.ItemImage, len(urls))
+		for i, url := range urls {
+			images[i] = models.ItemImage{ItemID: item.ID, URL: url, Position: i, IsCover: i == 0}
+		}
+
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&images).Error; err != nil {
+				return err
+			}
+			return tx.Model(&models.Item{}).Where("id = ?", item.ID).UpdateColumn("cover_image_url", urls[0]).Error
+		}); err != nil {
+			return err
+		}
+	}
+
+	if len(items) > 0 {
+		log.Printf("Migrated images of %d items to item_images", len(items))
+	}
+	return nil
+}
@@ -3,18 +3,46 @@ package firebase
 import (
 	"context"
 	"log"
+	"os"
+	"strings"
 
 	firebase "firebase.google.com/go/v4"
 	"firebase.google.com/go/v4/auth"
 	"google.golang.org/api/option"
 )
 
-// AuthClient はFirebase Authのクライアントを保持する
+// AuthClient はFirebase Authのクライアントを保持する (AUTH_PROVIDER=local の場合は nil)
 var AuthClient *auth.Client
 
+// Verifier は設定に応じて選択されたIDトークン検証器
+var Verifier TokenVerifier
+
+// TokenVerifier IDトークンを検証し、UIDとクレームを返す
+// *auth.Client はこのインターフェースをそのまま満たす
+type TokenVerifier interface {
+	VerifyIDToken(ctx context.Context, idToken string) (*auth.Token, error)
+}
+
 // InitFirebase Firebaseの初期化を実行
+// AUTH_PROVIDER=local の場合はGoogleに接続せず、開発用鍵で署名するローカル検証器を使う
 func InitFirebase() error {
-	opt := option.WithCredentialsFile("serviceAccountKey.json")
+	if strings.ToLower(os.Getenv("AUTH_PROVIDER")) == "local" {
+		key := os.Getenv("LOCAL_AUTH_KEY")
+		if key == "" {
+			log.Println("WARNING: LOCAL_AUTH_KEY is not set. Using the built-in development key.")
+			key = defaultLocalKey
+		}
+		Verifier = NewLocalVerifier([]byte(key))
+		log.Println("Local token verifier initialized!")
+		return nil
+	}
+
+	credsPath := os.Getenv("FIREBASE_CREDENTIALS_FILE")
+	if credsPath == "" {
+		credsPath = "serviceAccountKey.json"
+	}
+
+	opt := option.WithCredentialsFile(credsPath)
 	app, err := firebase.NewApp(context.Background(), nil, opt)
 	if err != nil {
 		return err
@@ -24,6 +52,13 @@ func InitFirebase() error {
 	if err != nil {
 		return err
 	}
+	Verifier = AuthClient
 	log.Println("Firebase Auth client initialized!")
 	return nil
 }
+
+// Local ローカル検証器が有効ならそれを返す
+func Local() (*LocalVerifier, bool) {
+	v, ok := Verifier.(*LocalVerifier)
+	return v, ok
+}
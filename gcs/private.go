@@ -0,0 +1,59 @@
+package gcs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// PrivateBucketName 本人確認書類など非公開ファイル用のバケット (公開URLは発行しない)
+func PrivateBucketName() string {
+	if name := os.Getenv("GCS_PRIVATE_BUCKET"); name != "" {
+		return name
+	}
+	return BucketName + "-private"
+}
+
+// GenerateSignedPrivateUploadURL 非公開バケットへのアップロード用の署名付きURLを生成する
+// objectName は呼び出し側で決め、DBにはURLではなくオブジェクト名を保存する
+func GenerateSignedPrivateUploadURL(ctx context.Context, objectName string, contentType string) (string, error) {
+	if StorageClient == nil {
+		return "", fmt.Errorf("gcs client is not initialized")
+	}
+
+	opts := &storage.SignedURLOptions{
+		Scheme:      storage.SigningSchemeV4,
+		Method:      "PUT",
+		Expires:     time.Now().Add(15 * time.Minute),
+		ContentType: contentType,
+		Headers:     []string{"Content-Length"},
+	}
+
+	signedURL, err := StorageClient.Bucket(PrivateBucketName()).SignedURL(objectName, opts)
+	if err != nil {
+		return "", fmt.Errorf("署名付きURLの生成に失敗しました（IAM権限を確認してください）: %w", err)
+	}
+	return signedURL, nil
+}
+
+// GenerateSignedReadURL 非公開バケットのファイルを短時間だけ閲覧できる署名付きURLを生成する (審査用)
+func GenerateSignedReadURL(ctx context.Context, objectName string) (string, error) {
+	if StorageClient == nil {
+		return "", fmt.Errorf("gcs client is not initialized")
+	}
+
+	opts := &storage.SignedURLOptions{
+		Scheme:  storage.SigningSchemeV4,
+		Method:  "GET",
+		Expires: time.Now().Add(5 * time.Minute),
+	}
+
+	signedURL, err := StorageClient.Bucket(PrivateBucketName()).SignedURL(objectName, opts)
+	if err != nil {
+		return "", fmt.Errorf("署名付きURLの生成に失敗しました: %w", err)
+	}
+	return signedURL, nil
+}
@@ -19,10 +19,13 @@ type AIResponse struct {
 	Price       int      `json:"price"`
 	Tags        []string `json:"tags"`
 	CategoryID  uint     `json:"category_id"`
+	// Attributes カテゴリの属性 (ブランド、サイズなど) の推測値。呼び出し側でカテゴリの定義と照合する
+	Attributes map[string]interface{} `json:"attributes"`
 }
 
 // AnalyzeImage 画像をGeminiに投げて解析結果を返す
-func AnalyzeImage(ctx context.Context, imagePath string, categoriesJSON string) (*AIResponse, error) {
+// attributesJSON はカテゴリごとの属性定義 (models.CategoryAttribute の配列)
+func AnalyzeImage(ctx context.Context, imagePath string, categoriesJSON string, attributesJSON string) (*AIResponse, error) {
 	projectID := os.Getenv("GCP_PROJECT_ID") // 後で環境変数に追加します
 	location := "us-central1"                // Geminiが使えるリージョン
 
@@ -67,15 +70,22 @@ func AnalyzeImage(ctx context.Context, imagePath string, categoriesJSON string)
 
 	**【重要】選択肢にないID (例: 1〜16のトップレベルID) は絶対に使用しないでください。**
 
+	- attributes: 選択した category_id、またはその親カテゴリ (parent_id) に定義された属性の値。
+	  キーは属性の name、値は文字列にしてください。type が ENUM の場合は allowed_values のいずれか、
+	  NUMBER の場合は unit の単位での数値のみ。画像から判断できない属性は含めないでください。
+	属性の定義:
+	%s
+
 	出力例:
 	{
 		"title": "NIKE エアジョーダン スニーカー 27cm",
 		"description": "数回使用した程度の美品です。人気の赤黒カラー...",
 		"price": 8500,
-		"tags": ["スニーカー", "NIKE", "靴", "メンズ", "エアジョーダン"]
-		"category_id": 105
+		"tags": ["スニーカー", "NIKE", "靴", "メンズ", "エアジョーダン"],
+		"category_id": 105,
+		"attributes": {"brand": "NIKE", "color": "レッド", "size": "27"}
 	}
-	`, categoriesJSON)
+	`, categoriesJSON, attributesJSON)
 
 	// AIへ送信
 	resp, err := model.GenerateContent(ctx,
@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Kousuke-irie/hackathon-backend/database"
+	"github.com/Kousuke-irie/hackathon-backend/lifecycle"
+	"github.com/Kousuke-irie/hackathon-backend/middleware"
+	"github.com/Kousuke-irie/hackathon-backend/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	withdrawnUsername = "退会済みユーザー"
+	defaultIconURL    = "https://www.gravatar.com/avatar/00000000000000000000000000000000?d=mp&f=y"
+)
+
+// DeleteAccountHandler 退会処理 (DELETE /users/me)
+// ユーザー行は匿名化して残し、取引 (Transaction) は会計記録のためそのまま保持する
+func DeleteAccountHandler(c *gin.Context) {
+	userID := middleware.CurrentUserID(c)
+	db := database.DBClient
+
+	// 💡 取引中 (発送前・配送中) の取引がある場合は退会できない
+	var activeCount int64
+	if err := db.Model(&models.Transaction{}).
+		Where("(buyer_id = ? OR seller_id = ?) AND status IN (?)", userID, userID, []string{models.TransactionPaymentPending, "PURCHASED", "SHIPPED"}).
+		Count(&activeCount).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check transactions"})
+		return
+	}
+	// 購入手続き中 (RESERVED、または在庫の一部を確保中) の出品がある場合も同様
+	var reservedCount int64
+	if err := db.Model(&models.Item{}).
+		Where("seller_id = ? AND (status = ? OR id IN (?))", userID, lifecycle.Reserved, db.Model(&models.StockHold{}).Select("item_id")).
+		Count(&reservedCount).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check items"})
+		return
+	}
+	// 入札のあるオークションを開催中、または最高額で入札中の場合も同様
+	var auctionCount int64
+	if err := db.Model(&models.Auction{}).
+		Where("status = ? AND ((seller_id = ? AND bid_count > 0) OR highest_bidder_id = ?)", models.AuctionOpen, userID, userID).
+		Count(&auctionCount).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check auctions"})
+		return
+	}
+	if activeCount > 0 || reservedCount > 0 || auctionCount > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "取引中の商品があるため退会できません"})
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// 1. フォロー関係を削除し、相手側のカウントを補正
+		if err := tx.Model(&models.User{}).
+			Where("id IN (?)", tx.Model(&models.Follow{}).Select("following_id").Where("follower_id = ?", userID)).
+			UpdateColumn("follower_count", gorm.Expr("GREATEST(follower_count - 1, 0)")).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.User{}).
+			Where("id IN (?)", tx.Model(&models.Follow{}).Select("follower_id").Where("following_id = ?", userID)).
+			UpdateColumn("following_count", gorm.Expr("GREATEST(following_count - 1, 0)")).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("follower_id = ? OR following_id = ?", userID, userID).Delete(&models.Follow{}).Error; err != nil {
+			return err
+		}
+
+		// 2. 出品中・一時停止中の商品は非公開 (下書き) に戻す。売却済みは取引記録のため残す
+		if err := tx.Model(&models.Item{}).
+			Where("seller_id = ? AND status IN (?)", userID, lifecycle.SourcesOf(lifecycle.Draft, lifecycle.ActorSystem)).
+			Update("status", lifecycle.Draft).Error; err != nil {
+			return err
+		}
+		// 予約出品は公開されないよう、公開日時を外す
+		if err := tx.Unscoped().Model(&models.Item{}).
+			Where("seller_id = ? AND publish_at IS NOT NULL", userID).
+			Update("publish_at", nil).Error; err != nil {
+			return err
+		}
+		// 入札のないオークションは取り消す
+		if err := tx.Model(&models.Auction{}).
+			Where("seller_id = ? AND status = ?", userID, models.AuctionOpen).
+			Update("status", models.AuctionCanceled).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Item{}).
+			Where("seller_id = ? AND listing_type = ? AND status = ?", userID, models.ListingAuction, lifecycle.Draft).
+			Update("listing_type", models.ListingFixed).Error; err != nil {
+			return err
+		}
+
+		// 3. 本人が書いたコンテンツを削除
+		if err := tx.Where("user_id = ?", userID).Delete(&models.Comment{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.CommunityPost{}).Error; err != nil {
+			return err
+		}
+		// 送信したメッセージは削除し、受信したメッセージは相手側の記録として残す
+		if err := tx.Where("sender_id = ?", userID).Delete(&models.Message{}).Error; err != nil {
+			return err
+		}
+
+		// 4. 評価は相手の評価値として残し、コメントのみ消去する
+		if err := tx.Model(&models.Review{}).Where("rater_id = ?", userID).Update("comment", "").Error; err != nil {
+			return err
+		}
+
+		// 5. 行動履歴・通知を削除
+		if err := tx.Where("user_id = ?", userID).Delete(&models.Like{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.ViewHistory{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.Notification{}).Error; err != nil {
+			return err
+		}
+
+		// 6. ユーザー行を匿名化し、ログイン手段とセッションを無効にする
+		return anonymizeUser(tx, userID)
+	})
+	if err != nil {
+		fmt.Printf("Account Deletion Error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deleted"})
+}
+
+// anonymizeUser ユーザー行を退会済みとして匿名化し、ログイン手段とセッションを無効にする
+// ログイン手段を外すため、同じFirebaseアカウントで再ログインすると新規ユーザーになる
+func anonymizeUser(tx *gorm.DB, userID uint64) error {
+	now := time.Now()
+	if err := tx.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&models.UserIdentity{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ? OR target_id = ?", userID, userID).Delete(&models.UserBlock{}).Error; err != nil {
+		return err
+	}
+	// 住所録は削除する (取引に保存された配送先は会計記録として残る)
+	if err := tx.Where("user_id = ?", userID).Delete(&models.Address{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("seller_id = ?", userID).Delete(&models.ShippingRule{}).Error; err != nil {
+		return err
+	}
+	// 応答待ちの値下げ交渉は見送りにする
+	if err := tx.Model(&models.Offer{}).
+		Where("(buyer_id = ? OR seller_id = ?) AND status IN ?", userID, userID, []string{models.OfferPending, models.OfferCountered}).
+		Update("status", models.OfferDeclined).Error; err != nil {
+		return err
+	}
+
+	return tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"firebase_uid":    fmt.Sprintf("withdrawn-%d", userID),
+		"email":           fmt.Sprintf("withdrawn-%d@invalid", userID),
+		"username":        withdrawnUsername,
+		"icon_url":        defaultIconURL,
+		"bio":             "",
+		"address":         "",
+		"birthdate":       "",
+		"following_count": 0,
+		"follower_count":  0,
+		"role":            models.RoleUser,
+		"verified_at":     nil,
+		"withdrawn_at":    &now,
+	}).Error
+}
+
+// ExportAccountDataHandler 自分のデータを JSON ファイルにまとめた zip で返す (GET /users/me/export)
+func ExportAccountDataHandler(c *gin.Context) {
+	userID := middleware.CurrentUserID(c)
+	db := database.DBClient
+
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var (
+		items         []models.Item
+		transactions  []models.Transaction
+		orders        []models.Order
+		offers        []models.Offer
+		auctions      []models.Auction
+		bids          []models.Bid
+		likes         []models.Like
+		comments      []models.Comment
+		posts         []models.CommunityPost
+		messages      []models.Message
+		follows       []models.Follow
+		reviews       []models.Review
+		notifications []models.Notification
+		views         []models.ViewHistory
+		identities    []models.UserIdentity
+		blocks        []models.UserBlock
+		addresses     []models.Address
+		verifications []models.SellerVerification
+		shippingRules []models.ShippingRule
+	)
+	queries := []*gorm.DB{
+		db.Where("seller_id = ?", userID).Find(&items),
+		db.Where("buyer_id = ? OR seller_id = ?", userID, userID).Find(&transactions),
+		db.Where("buyer_id = ? OR seller_id = ?", userID, userID).Find(&orders),
+		db.Where("buyer_id = ? OR seller_id = ?", userID, userID).Find(&offers),
+		db.Where("seller_id = ?", userID).Find(&auctions),
+		db.Where("bidder_id = ?", userID).Find(&bids),
+		db.Where("user_id = ?", userID).Find(&likes),
+		db.Where("user_id = ?", userID).Find(&comments),
+		db.Where("user_id = ?", userID).Find(&posts),
+		db.Where("sender_id = ? OR receiver_id = ?", userID, userID).Find(&messages),
+		db.Where("follower_id = ? OR following_id = ?", userID, userID).Find(&follows),
+		db.Where("rater_id = ?", userID).Find(&reviews),
+		db.Where("user_id = ?", userID).Find(&notifications),
+		db.Where("user_id = ?", userID).Find(&views),
+		db.Where("user_id = ?", userID).Find(&identities),
+		db.Where("user_id = ?", userID).Find(&blocks),
+		db.Where("user_id = ?", userID).Find(&addresses),
+		db.Where("user_id = ?", userID).Find(&verifications),
+		db.Where("seller_id = ?", userID).Find(&shippingRules),
+	}
+	for _, q := range queries {
+		if q.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to collect account data"})
+			return
+		}
+	}
+
+	files := []struct {
+		Name string
+		Data interface{}
+	}{
+		{"user.json", user.Self()},
+		{"items.json", items},
+		{"transactions.json", transactions},
+		{"orders.json", orders},
+		{"offers.json", offers},
+		{"auctions.json", auctions},
+		{"bids.json", bids},
+		{"likes.json", likes},
+		{"comments.json", comments},
+		{"community_posts.json", posts},
+		{"messages.json", messages},
+		{"follows.json", follows},
+		{"reviews.json", reviews},
+		{"notifications.json", notifications},
+		{"view_histories.json", views},
+		{"identities.json", identities},
+		{"blocks.json", blocks},
+		{"addresses.json", addresses},
+		{"verifications.json", verifications},
+		{"shipping_rules.json", shippingRules},
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="account-%d-export.zip"`, userID))
+	c.Status(http.StatusOK)
+
+	zw := zip.NewWriter(c.Writer)
+	for _, f := range files {
+		w, err := zw.Create(f.Name)
+		if err != nil {
+			fmt.Printf("Export Error: %v\n", err)
+			return
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.Data); err != nil {
+			fmt.Printf("Export Error: %v\n", err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		fmt.Printf("Export Error: %v\n", err)
+	}
+}
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/Kousuke-irie/hackathon-backend/database"
+	"github.com/Kousuke-irie/hackathon-backend/lifecycle"
+	"github.com/Kousuke-irie/hackathon-backend/middleware"
+	"github.com/Kousuke-irie/hackathon-backend/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var postalCodePattern = regexp.MustCompile(`^\d{7}$`)
+
+// errNoShippingAddress 配送先が指定されておらず、既定の住所も登録されていない
+var errNoShippingAddress = errors.New("no shipping address")
+
+// AddressRequest 住所の登録・更新用リクエスト
+type AddressRequest struct {
+	RecipientName string `json:"recipient_name" binding:"required"`
+	PostalCode    string `json:"postal_code" binding:"required"`
+	Prefecture    string `json:"prefecture" binding:"required"`
+	City          string `json:"city" binding:"required"`
+	Line1         string `json:"line1" binding:"required"`
+	Line2         string `json:"line2"`
+	Phone         string `json:"phone" binding:"required"`
+	IsDefault     bool   `json:"is_default"`
+}
+
+// apply リクエストの内容を住所に反映する (郵便番号のハイフンは取り除く)
+func (r AddressRequest) apply(a *models.Address) bool {
+	postalCode := strings.ReplaceAll(r.PostalCode, "-", "")
+	if !postalCodePattern.MatchString(postalCode) {
+		return false
+	}
+	a.RecipientName = r.RecipientName
+	a.PostalCode = postalCode
+	a.Prefecture = r.Prefecture
+	a.City = r.City
+	a.Line1 = r.Line1
+	a.Line2 = r.Line2
+	a.Phone = r.Phone
+	return true
+}
+
+// GetAddressesHandler 自分の住所録を取得 (既定の住所が先頭)
+func GetAddressesHandler(c *gin.Context) {
+	var addresses []models.Address
+	if err := database.DBClient.Where("user_id = ?", middleware.CurrentUserID(c)).
+		Order("is_default DESC, id ASC").
+		Find(&addresses).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch addresses"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"addresses": addresses})
+}
+
+// CreateAddressHandler 住所を登録 (最初の1件は自動的に既定の住所になる)
+func CreateAddressHandler(c *gin.Context) {
+	var req AddressRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userID := middleware.CurrentUserID(c)
+	address := models.Address{UserID: userID}
+	if !req.apply(&address) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "郵便番号は7桁の数字で入力してください"})
+		return
+	}
+
+	err := database.DBClient.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		tx.Model(&models.Address{}).Where("user_id = ?", userID).Count(&count)
+		if err := tx.Create(&address).Error; err != nil {
+			return err
+		}
+		if req.IsDefault || count == 0 {
+			return setDefaultAddress(tx, userID, &address)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create address"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"address": address})
+}
+
+// UpdateAddressHandler 住所を更新 (過去の取引に保存された配送先は変わらない)
+func UpdateAddressHandler(c *gin.Context) {
+	var req AddressRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userID := middleware.CurrentUserID(c)
+	var address models.Address
+	if err := database.DBClient.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&address).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Address not found"})
+		return
+	}
+	if !req.apply(&address) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "郵便番号は7桁の数字で入力してください"})
+		return
+	}
+
+	err := database.DBClient.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&address).Error; err != nil {
+			return err
+		}
+		if req.IsDefault && !address.IsDefault {
+			return setDefaultAddress(tx, userID, &address)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update address"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"address": address})
+}
+
+// SetDefaultAddressHandler 既定の配送先を変更 (PUT /users/me/addresses/:id/default)
+func SetDefaultAddressHandler(c *gin.Context) {
+	userID := middleware.CurrentUserID(c)
+	var address models.Address
+	if err := database.DBClient.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&address).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Address not found"})
+		return
+	}
+
+	if err := database.DBClient.Transaction(func(tx *gorm.DB) error {
+		return setDefaultAddress(tx, userID, &address)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update default address"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"address": address})
+}
+
+// DeleteAddressHandler 住所を削除 (既定の住所を消した場合は最も古い住所を既定にする)
+func DeleteAddressHandler(c *gin.Context) {
+	userID := middleware.CurrentUserID(c)
+	var address models.Address
+	if err := database.DBClient.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&address).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Address not found"})
+		return
+	}
+
+	// 購入手続き中の配送先は、購入の確定で使うため削除できない
+	var reservedCount int64
+	if err := database.DBClient.Model(&models.Item{}).
+		Where("reserved_address_id = ? AND status = ?", address.ID, lifecycle.Reserved).
+		Count(&reservedCount).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete address"})
+		return
+	}
+	if reservedCount > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "購入手続き中の配送先は削除できません"})
+		return
+	}
+
+	err := database.DBClient.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&address).Error; err != nil {
+			return err
+		}
+		if !address.IsDefault {
+			return nil
+		}
+		var next models.Address
+		if err := tx.Where("user_id = ?", userID).Order("id ASC").First(&next).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+		return setDefaultAddress(tx, userID, &next)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete address"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Address deleted"})
+}
+
+// setDefaultAddress 指定の住所だけを既定にする
+func setDefaultAddress(tx *gorm.DB, userID uint64, address *models.Address) error {
+	if err := tx.Model(&models.Address{}).
+		Where("user_id = ? AND id != ?", userID, address.ID).
+		Update("is_default", false).Error; err != nil {
+		return err
+	}
+	address.IsDefault = true
+	return tx.Model(address).Update("is_default", true).Error
+}
+
+// resolveShippingAddress 購入時の配送先を決める (addressID が 0 なら既定の住所)
+func resolveShippingAddress(userID, addressID uint64) (models.Address, error) {
+	var address models.Address
+	query := database.DBClient.Where("user_id = ?", userID)
+	if addressID != 0 {
+		query = query.Where("id = ?", addressID)
+	} else {
+		query = query.Where("is_default = ?", true)
+	}
+	if err := query.First(&address).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return address, errNoShippingAddress
+		}
+		return address, err
+	}
+	return address, nil
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Kousuke-irie/hackathon-backend/database"
+	"github.com/Kousuke-irie/hackathon-backend/middleware"
+	"github.com/Kousuke-irie/hackathon-backend/models"
+	"github.com/gin-gonic/gin"
+)
+
+// GetAdminUsersHandler ユーザー一覧を取得 (名前・メールアドレスで検索可)
+func GetAdminUsersHandler(c *gin.Context) {
+	queryParam := c.Query("q")
+	role := c.Query("role")
+
+	query := database.DBClient.Model(&models.User{})
+	if queryParam != "" {
+		searchQuery := fmt.Sprintf("%%%s%%", queryParam)
+		query = query.Where("username LIKE ? OR email LIKE ?", searchQuery, searchQuery)
+	}
+	if role != "" {
+		query = query.Where("role = ?", role)
+	}
+
+	var users []models.User
+	if err := query.Order("id DESC").Limit(50).Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+
+	// 管理者向けにはメールアドレスなどを含めて返す
+	result := make([]models.SelfUser, len(users))
+	for i, u := range users {
+		result[i] = u.Self()
+	}
+	c.JSON(http.StatusOK, gin.H{"users": result})
+}
+
+// UpdateUserRoleHandler ユーザーの役割を変更 (PUT /admin/users/:id/role)
+func UpdateUserRoleHandler(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role is required"})
+		return
+	}
+	if req.Role != models.RoleUser && req.Role != models.RoleModerator && req.Role != models.RoleAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	}
+
+	// 💡 自分自身の権限を外して管理者不在になるのを防ぐ
+	if userID == middleware.CurrentUserID(c) && req.Role != models.RoleAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot demote yourself"})
+		return
+	}
+
+	db := database.DBClient
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := db.Model(&user).Update("role", req.Role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role updated", "user": user.Self()})
+}
+
+// DeleteCommentByModeratorHandler 不適切なコメントを削除
+func DeleteCommentByModeratorHandler(c *gin.Context) {
+	result := database.DBClient.Delete(&models.Comment{}, c.Param("id"))
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Comment deleted"})
+}
+
+// DeleteCommunityPostByModeratorHandler 不適切なコミュニティ投稿を削除
+func DeleteCommunityPostByModeratorHandler(c *gin.Context) {
+	result := database.DBClient.Delete(&models.CommunityPost{}, c.Param("id"))
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete post"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Post deleted"})
+}
@@ -0,0 +1,401 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Kousuke-irie/hackathon-backend/database"
+	"github.com/Kousuke-irie/hackathon-backend/middleware"
+	"github.com/Kousuke-irie/hackathon-backend/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultStatsDays 分析画面の既定の集計期間 (日数)
+	defaultStatsDays = 30
+	// maxStatsDays 集計できる最大の期間。起動時にこの日数分の日別集計を作り直す
+	maxStatsDays = 90
+	// topItemsLimit ショップ分析で返す閲覧数上位の商品数
+	topItemsLimit   = 10
+	statsDateFormat = "2006-01-02"
+)
+
+// StatsTotals 集計期間の合計
+type StatsTotals struct {
+	Views          int     `json:"views"`
+	UniqueViewers  int     `json:"unique_viewers"` // 期間内の閲覧者数 (日別の合計ではなく重複を除いた人数)
+	Likes          int     `json:"likes"`
+	Nopes          int     `json:"nopes"`
+	NopeRate       float64 `json:"nope_rate"` // スワイプのうち NOPE の割合
+	Comments       int     `json:"comments"`
+	Purchases      int     `json:"purchases"`
+	Revenue        int     `json:"revenue"`
+	ConversionRate float64 `json:"conversion_rate"` // 閲覧者数に対する購入数の割合
+}
+
+// DailyStat 日別の集計 (活動のない日も 0 で埋める)
+type DailyStat struct {
+	Date          string `json:"date"`
+	Views         int    `json:"views"`
+	UniqueViewers int    `json:"unique_viewers"` // ショップ全体では商品ごとの閲覧者数の合計
+	Likes         int    `json:"likes"`
+	Nopes         int    `json:"nopes"`
+	Comments      int    `json:"comments"`
+	Purchases     int    `json:"purchases"`
+	Revenue       int    `json:"revenue"`
+}
+
+// StartStatsRollup 日別集計 (ItemDailyStat) を定期的に作り直す
+// 起動時に直近 maxStatsDays 日分を作り直し、以降は今日と昨日の分と、状態が変わった取引の作成日の分を interval ごとに更新する
+func StartStatsRollup(interval time.Duration) {
+	go func() {
+		lastRun := time.Now()
+		today := startOfDay(lastRun)
+		for i := maxStatsDays - 1; i >= 0; i-- {
+			if err := rollupItemStats(today.AddDate(0, 0, -i)); err != nil {
+				log.Printf("Stats rollup: failed to backfill %s: %v", today.AddDate(0, 0, -i).Format(statsDateFormat), err)
+			}
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			now := time.Now()
+			today := startOfDay(now)
+			// 日付が変わった直後も前日分の終わりまでを反映できるよう、昨日の分も作り直す
+			days := []time.Time{today.AddDate(0, 0, -1), today}
+			// 購入は取引の作成日で数えるため、後から支払い・キャンセルされた取引はその作成日の分を作り直す
+			changed, err := changedTransactionDays(lastRun, today.AddDate(0, 0, -(maxStatsDays-1)), today.AddDate(0, 0, -1))
+			if err != nil {
+				log.Printf("Stats rollup: failed to fetch changed transactions: %v", err)
+				continue
+			}
+			lastRun = now
+			for _, day := range append(changed, days...) {
+				if err := rollupItemStats(day); err != nil {
+					log.Printf("Stats rollup: failed to roll up %s: %v", day.Format(statsDateFormat), err)
+				}
+			}
+		}
+	}()
+}
+
+// changedTransactionDays since 以降に更新された取引の作成日のうち、from 以降 before より前の日付を返す
+func changedTransactionDays(since, from, before time.Time) ([]time.Time, error) {
+	var createdAts []time.Time
+	if err := database.DBClient.Model(&models.Transaction{}).
+		Where("updated_at >= ? AND created_at >= ? AND created_at < ?", since, from, before).
+		Pluck("created_at", &createdAts).Error; err != nil {
+		return nil, err
+	}
+	seen := map[time.Time]bool{}
+	var days []time.Time
+	for _, t := range createdAts {
+		day := startOfDay(t)
+		if !seen[day] {
+			seen[day] = true
+			days = append(days, day)
+		}
+	}
+	return days, nil
+}
+
+// startOfDay サーバーのタイムゾーンでの日付の始まり
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// rollupItemStats 指定日の閲覧・スワイプ・コメント・購入を商品ごとに集計し、その日の ItemDailyStat を置き換える
+// 出品者自身の閲覧・コメントは数えない
+func rollupItemStats(day time.Time) error {
+	from := startOfDay(day)
+	to := from.AddDate(0, 0, 1)
+	db := database.DBClient
+
+	stats := map[uint64]*models.ItemDailyStat{}
+	row := func(itemID, sellerID uint64) *models.ItemDailyStat {
+		s, ok := stats[itemID]
+		if !ok {
+			s = &models.ItemDailyStat{ItemID: itemID, SellerID: sellerID, Date: from}
+			stats[itemID] = s
+		}
+		return s
+	}
+
+	var views []struct {
+		ItemID        uint64
+		SellerID      uint64
+		Views         int
+		UniqueViewers int
+	}
+	if err := db.Table("view_histories AS v").
+		Select("v.item_id, i.seller_id, COUNT(*) AS views, COUNT(DISTINCT v.user_id) AS unique_viewers").
+		Joins("JOIN items AS i ON i.id = v.item_id").
+		Where("v.created_at >= ? AND v.created_at < ? AND v.user_id <> i.seller_id", from, to).
+		Group("v.item_id, i.seller_id").
+		Scan(&views).Error; err != nil {
+		return err
+	}
+	for _, v := range views {
+		s := row(v.ItemID, v.SellerID)
+		s.Views, s.UniqueViewers = v.Views, v.UniqueViewers
+	}
+
+	var reactions []struct {
+		ItemID   uint64
+		SellerID uint64
+		Likes    int
+		Nopes    int
+	}
+	if err := db.Table("likes AS l").
+		Select("l.item_id, i.seller_id, SUM(l.reaction = 'LIKE') AS likes, SUM(l.reaction = 'NOPE') AS nopes").
+		Joins("JOIN items AS i ON i.id = l.item_id").
+		Where("l.created_at >= ? AND l.created_at < ?", from, to).
+		Group("l.item_id, i.seller_id").
+		Scan(&reactions).Error; err != nil {
+		return err
+	}
+	for _, r := range reactions {
+		s := row(r.ItemID, r.SellerID)
+		s.Likes, s.Nopes = r.Likes, r.Nopes
+	}
+
+	var comments []struct {
+		ItemID   uint64
+		SellerID uint64
+		Comments int
+	}
+	if err := db.Table("comments AS c").
+		Select("c.item_id, i.seller_id, COUNT(*) AS comments").
+		Joins("JOIN items AS i ON i.id = c.item_id").
+		Where("c.created_at >= ? AND c.created_at < ? AND c.user_id <> i.seller_id", from, to).
+		Group("c.item_id, i.seller_id").
+		Scan(&comments).Error; err != nil {
+		return err
+	}
+	for _, cm := range comments {
+		row(cm.ItemID, cm.SellerID).Comments = cm.Comments
+	}
+
+	// 支払い待ち (落札後の未決済) とキャンセルされた取引は購入に数えない
+	var purchases []struct {
+		ItemID    uint64
+		SellerID  uint64
+		Purchases int
+		Revenue   int
+	}
+	if err := db.Model(&models.Transaction{}).
+		Select("item_id, seller_id, SUM(quantity) AS purchases, SUM(price_snapshot * quantity) AS revenue").
+		Where("created_at >= ? AND created_at < ? AND status NOT IN ?", from, to, []string{models.TransactionPaymentPending, "CANCELED"}).
+		Group("item_id, seller_id").
+		Scan(&purchases).Error; err != nil {
+		return err
+	}
+	for _, p := range purchases {
+		s := row(p.ItemID, p.SellerID)
+		s.Purchases, s.Revenue = p.Purchases, p.Revenue
+	}
+
+	rows := make([]models.ItemDailyStat, 0, len(stats))
+	for _, s := range stats {
+		rows = append(rows, *s)
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("date = ?", from).Delete(&models.ItemDailyStat{}).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(rows, 200).Error
+	})
+}
+
+// parseStatsDays 集計期間 (?days=) を読み取り、開始日を返す
+func parseStatsDays(c *gin.Context) (int, time.Time, bool) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", strconv.Itoa(defaultStatsDays)))
+	if err != nil || days < 1 || days > maxStatsDays {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "days は 1〜" + strconv.Itoa(maxStatsDays) + " で指定してください"})
+		return 0, time.Time{}, false
+	}
+	return days, startOfDay(time.Now()).AddDate(0, 0, -(days - 1)), true
+}
+
+// buildStats 日別集計の行から期間の合計と 0 埋めした日別の推移を作る
+// 期間のユニーク閲覧者数は日別の値を足せないため、呼び出し側で別に数えて渡す
+func buildStats(rows []models.ItemDailyStat, from time.Time, days int, uniqueViewers int) (StatsTotals, []DailyStat) {
+	daily := make([]DailyStat, days)
+	index := make(map[string]int, days)
+	for i := range daily {
+		date := from.AddDate(0, 0, i).Format(statsDateFormat)
+		daily[i].Date = date
+		index[date] = i
+	}
+
+	totals := StatsTotals{UniqueViewers: uniqueViewers}
+	for _, r := range rows {
+		totals.Views += r.Views
+		totals.Likes += r.Likes
+		totals.Nopes += r.Nopes
+		totals.Comments += r.Comments
+		totals.Purchases += r.Purchases
+		totals.Revenue += r.Revenue
+
+		i, ok := index[r.Date.Format(statsDateFormat)]
+		if !ok {
+			continue
+		}
+		d := &daily[i]
+		d.Views += r.Views
+		d.UniqueViewers += r.UniqueViewers
+		d.Likes += r.Likes
+		d.Nopes += r.Nopes
+		d.Comments += r.Comments
+		d.Purchases += r.Purchases
+		d.Revenue += r.Revenue
+	}
+
+	if swipes := totals.Likes + totals.Nopes; swipes > 0 {
+		totals.NopeRate = float64(totals.Nopes) / float64(swipes)
+	}
+	if totals.UniqueViewers > 0 {
+		totals.ConversionRate = float64(totals.Purchases) / float64(totals.UniqueViewers)
+	}
+	return totals, daily
+}
+
+// GetItemStatsHandler 出品した商品の反応の集計を取得 (GET /items/:id/stats?days=30)
+// 💡 集計は日別集計 (ItemDailyStat) から返すため、当日分は数分遅れで反映される
+func GetItemStatsHandler(c *gin.Context) {
+	userID := middleware.CurrentUserID(c)
+	var item models.Item
+	if err := database.DBClient.Unscoped().First(&item, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+	if item.SellerID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "出品者のみ閲覧できます"})
+		return
+	}
+	days, from, ok := parseStatsDays(c)
+	if !ok {
+		return
+	}
+
+	var rows []models.ItemDailyStat
+	if err := database.DBClient.Where("item_id = ? AND date >= ?", item.ID, from).Find(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stats"})
+		return
+	}
+	var uniqueViewers int64
+	if err := database.DBClient.Model(&models.ViewHistory{}).
+		Where("item_id = ? AND created_at >= ? AND user_id <> ?", item.ID, from, item.SellerID).
+		Distinct("user_id").
+		Count(&uniqueViewers).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stats"})
+		return
+	}
+
+	totals, daily := buildStats(rows, from, days, int(uniqueViewers))
+	c.JSON(http.StatusOK, gin.H{
+		"item_id": item.ID,
+		"from":    from.Format(statsDateFormat),
+		"days":    days,
+		"totals":  totals,
+		"daily":   daily,
+	})
+}
+
+// GetMyAnalyticsHandler 自分のショップ全体の反応の集計と、閲覧数の多い商品を取得 (GET /my/analytics?days=30)
+func GetMyAnalyticsHandler(c *gin.Context) {
+	userID := middleware.CurrentUserID(c)
+	days, from, ok := parseStatsDays(c)
+	if !ok {
+		return
+	}
+	db := database.DBClient
+
+	var rows []models.ItemDailyStat
+	if err := db.Where("seller_id = ? AND date >= ?", userID, from).Find(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch analytics"})
+		return
+	}
+	var uniqueViewers int64
+	if err := db.Table("view_histories AS v").
+		Joins("JOIN items AS i ON i.id = v.item_id").
+		Where("i.seller_id = ? AND v.created_at >= ? AND v.user_id <> ?", userID, from, userID).
+		Distinct("v.user_id").
+		Count(&uniqueViewers).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch analytics"})
+		return
+	}
+	totals, daily := buildStats(rows, from, days, int(uniqueViewers))
+
+	// 商品ごとの期間合計 (閲覧数の多い順)
+	var top []struct {
+		ItemID    uint64 `json:"item_id"`
+		Views     int    `json:"views"`
+		Likes     int    `json:"likes"`
+		Nopes     int    `json:"nopes"`
+		Comments  int    `json:"comments"`
+		Purchases int    `json:"purchases"`
+		Revenue   int    `json:"revenue"`
+	}
+	if err := db.Model(&models.ItemDailyStat{}).
+		Select("item_id, SUM(views) AS views, SUM(likes) AS likes, SUM(nopes) AS nopes, SUM(comments) AS comments, SUM(purchases) AS purchases, SUM(revenue) AS revenue").
+		Where("seller_id = ? AND date >= ?", userID, from).
+		Group("item_id").
+		Order("views DESC, item_id DESC").
+		Limit(topItemsLimit).
+		Scan(&top).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch analytics"})
+		return
+	}
+
+	itemIDs := make([]uint64, 0, len(top))
+	for _, t := range top {
+		itemIDs = append(itemIDs, t.ItemID)
+	}
+	var items []models.Item
+	if len(itemIDs) > 0 {
+		if err := db.Unscoped().Select("id", "title", "cover_image_url", "price", "status").
+			Where("id IN ?", itemIDs).Find(&items).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch analytics"})
+			return
+		}
+	}
+	itemByID := make(map[uint64]models.Item, len(items))
+	for _, item := range items {
+		itemByID[item.ID] = item
+	}
+
+	topItems := make([]gin.H, 0, len(top))
+	for _, t := range top {
+		item := itemByID[t.ItemID]
+		topItems = append(topItems, gin.H{
+			"item_id":         t.ItemID,
+			"title":           item.Title,
+			"cover_image_url": item.CoverImageURL,
+			"price":           item.Price,
+			"status":          item.Status,
+			"views":           t.Views,
+			"likes":           t.Likes,
+			"nopes":           t.Nopes,
+			"comments":        t.Comments,
+			"purchases":       t.Purchases,
+			"revenue":         t.Revenue,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":      from.Format(statsDateFormat),
+		"days":      days,
+		"totals":    totals,
+		"daily":     daily,
+		"top_items": topItems,
+	})
+}
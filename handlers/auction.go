@@ -0,0 +1,755 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Kousuke-irie/hackathon-backend/database"
+	"github.com/Kousuke-irie/hackathon-backend/lifecycle"
+	"github.com/Kousuke-irie/hackathon-backend/middleware"
+	"github.com/Kousuke-irie/hackathon-backend/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stripe/stripe-go/v79"
+	"github.com/stripe/stripe-go/v79/paymentintent"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// minAuctionDuration / maxAuctionDuration 開始から終了までに指定できる期間
+	minAuctionDuration = time.Hour
+	maxAuctionDuration = 14 * 24 * time.Hour
+	// antiSnipeWindow 終了までこの時間を切ってから入札があると、終了を入札からこの時間後まで延長する
+	antiSnipeWindow = 5 * time.Minute
+	// auctionPaymentWindow 落札から支払いまでの期限
+	auctionPaymentWindow = 72 * time.Hour
+)
+
+var (
+	// errAuctionClosed オークションが終了している (または開催されていない)
+	errAuctionClosed = errors.New("auction is closed")
+	// errAuctionHasBids 入札があるため取り消せない
+	errAuctionHasBids = errors.New("auction already has bids")
+	// errAlreadyHighestBidder 既に最高額で入札している
+	errAlreadyHighestBidder = errors.New("already the highest bidder")
+	// errBidTooLow 入札額が最低入札額に満たない
+	errBidTooLow = errors.New("bid is lower than the minimum")
+)
+
+// minBidIncrement 現在価格に対する入札単位
+func minBidIncrement(price int) int {
+	switch {
+	case price < 1000:
+		return 10
+	case price < 5000:
+		return 100
+	case price < 10000:
+		return 250
+	case price < 50000:
+		return 500
+	default:
+		return 1000
+	}
+}
+
+// minNextBid 次の入札に必要な最低額 (最初の入札は開始価格から)
+func minNextBid(auction models.Auction) int {
+	if auction.BidCount == 0 {
+		return auction.StartPrice
+	}
+	return auction.CurrentPrice + minBidIncrement(auction.CurrentPrice)
+}
+
+// extendAuctionEnd 終了まで antiSnipeWindow を切ってからの入札であれば、延長後の終了日時と true を返す
+func extendAuctionEnd(endsAt, bidAt time.Time) (time.Time, bool) {
+	if endsAt.Sub(bidAt) < antiSnipeWindow {
+		return bidAt.Add(antiSnipeWindow), true
+	}
+	return endsAt, false
+}
+
+// isOpenAuctionItem オークション開催中の商品か (定額での購入・値下げ交渉・出品者による変更の対象外)
+func isOpenAuctionItem(item models.Item) bool {
+	return item.ListingType == models.ListingAuction && item.Status == lifecycle.OnSale
+}
+
+// auctionView オークションのレスポンス。最低落札価格の金額は出品者にのみ返す
+func auctionView(auction models.Auction, viewerID uint64) gin.H {
+	view := gin.H{
+		"auction":      auction,
+		"has_reserve":  auction.ReservePrice != nil,
+		"reserve_met":  auction.ReserveMet(),
+		"min_next_bid": minNextBid(auction),
+	}
+	if viewerID == auction.SellerID && auction.ReservePrice != nil {
+		view["reserve_price"] = *auction.ReservePrice
+	}
+	return view
+}
+
+// StartAuctionHandler 自分の商品をオークション形式で出品する (POST /items/:id/auction)
+// 下書き・出品中・一時停止中の在庫1点の商品が対象。開始価格が商品の価格になり、入札のたびに現在価格に更新される
+func StartAuctionHandler(c *gin.Context) {
+	var req struct {
+		StartPrice   int       `json:"start_price" binding:"required"`
+		ReservePrice *int      `json:"reserve_price"` // 省略時は最低落札価格なし
+		EndsAt       time.Time `json:"ends_at" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "start_price and ends_at (RFC3339) are required"})
+		return
+	}
+	now := time.Now()
+	if req.StartPrice < minOfferAmount {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("開始価格は%d円以上で指定してください", minOfferAmount)})
+		return
+	}
+	if req.ReservePrice != nil && *req.ReservePrice < req.StartPrice {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "最低落札価格は開始価格以上で指定してください"})
+		return
+	}
+	if req.EndsAt.Before(now.Add(minAuctionDuration)) || req.EndsAt.After(now.Add(maxAuctionDuration)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ends_at must be between 1 hour and 14 days from now"})
+		return
+	}
+
+	item, ok := loadOwnItem(c)
+	if !ok {
+		return
+	}
+	if item.Status != lifecycle.Draft && item.Status != lifecycle.OnSale && item.Status != lifecycle.Paused {
+		c.JSON(http.StatusConflict, gin.H{"error": "この商品はオークションに出品できません"})
+		return
+	}
+	if item.Stock != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "オークションに出品できるのは在庫が1点の商品のみです"})
+		return
+	}
+	if err := database.DBClient.Preload("Seller").Preload("Images").Preload("Attributes").First(&item, item.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch item"})
+		return
+	}
+	oldPrice := item.Price
+	item.Price = req.StartPrice
+	if err := validatePublishable(item); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	from := item.Status
+	auction := models.Auction{
+		ItemID:         item.ID,
+		SellerID:       item.SellerID,
+		StartPrice:     req.StartPrice,
+		ReservePrice:   req.ReservePrice,
+		CurrentPrice:   req.StartPrice,
+		EndsAt:         req.EndsAt,
+		OriginalEndsAt: req.EndsAt,
+		Status:         models.AuctionOpen,
+	}
+	var notifications []models.Notification
+	err := database.DBClient.Transaction(func(tx *gorm.DB) (err error) {
+		if err := lifecycle.MoveWith(tx, &item, lifecycle.OnSale, lifecycle.ActorSeller, map[string]interface{}{
+			"price":        req.StartPrice,
+			"listing_type": models.ListingAuction,
+		}); err != nil {
+			return err
+		}
+		if err := tx.Create(&auction).Error; err != nil {
+			return err
+		}
+		if oldPrice != req.StartPrice {
+			notifications, err = recordPriceChange(tx, item, oldPrice, item.SellerID)
+		}
+		return err
+	})
+	if !respondItemTransition(c, err, from, lifecycle.OnSale) {
+		return
+	}
+	broadcastNotifications(notifications)
+	item.ListingType = models.ListingAuction
+
+	view := auctionView(auction, item.SellerID)
+	view["message"] = "Auction started"
+	view["item"] = item
+	c.JSON(http.StatusCreated, view)
+}
+
+// CancelAuctionHandler 入札のないオークションを取り消して商品を下書きに戻す (DELETE /items/:id/auction)
+func CancelAuctionHandler(c *gin.Context) {
+	var item models.Item
+	if err := database.DBClient.First(&item, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+	if item.SellerID != middleware.CurrentUserID(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have permission to edit this item"})
+		return
+	}
+
+	err := database.DBClient.Transaction(func(tx *gorm.DB) error {
+		// 取り消しと同時の入札を防ぐため、オークションの行をロックしてから入札数を確認する
+		var auction models.Auction
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("item_id = ? AND status = ?", item.ID, models.AuctionOpen).
+			First(&auction).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errAuctionClosed
+			}
+			return err
+		}
+		if auction.BidCount > 0 {
+			return errAuctionHasBids
+		}
+		if err := tx.Model(&auction).Update("status", models.AuctionCanceled).Error; err != nil {
+			return err
+		}
+		return lifecycle.MoveWith(tx, &item, lifecycle.Draft, lifecycle.ActorSeller, map[string]interface{}{
+			"listing_type": models.ListingFixed,
+		})
+	})
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, gin.H{"message": "Auction canceled"})
+	case errors.Is(err, errAuctionClosed):
+		c.JSON(http.StatusNotFound, gin.H{"error": "開催中のオークションがありません"})
+	case errors.Is(err, errAuctionHasBids):
+		c.JSON(http.StatusConflict, gin.H{"error": "入札のあるオークションは取り消せません"})
+	case errors.Is(err, lifecycle.ErrInvalidTransition), errors.Is(err, lifecycle.ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": "Item status was changed. Please reload and try again"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel auction"})
+	}
+}
+
+// GetAuctionHandler 商品の最新のオークションと入札の上位を取得 (GET /items/:id/auction)
+func GetAuctionHandler(c *gin.Context) {
+	var auction models.Auction
+	if err := database.DBClient.Where("item_id = ?", c.Param("id")).Order("id DESC").First(&auction).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Auction not found"})
+		return
+	}
+
+	var bids []models.Bid
+	if err := database.DBClient.Preload("Bidder").
+		Where("auction_id = ?", auction.ID).
+		Order("amount DESC").
+		Limit(20).
+		Find(&bids).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch bids"})
+		return
+	}
+
+	view := auctionView(auction, middleware.CurrentUserID(c))
+	view["bids"] = bids
+	c.JSON(http.StatusOK, view)
+}
+
+// PlaceBidHandler オークションに入札する (POST /items/:id/bids)
+// 直前の最高入札者には WebSocket で即時に通知する
+func PlaceBidHandler(c *gin.Context) {
+	var req struct {
+		Amount int `json:"amount" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount is required"})
+		return
+	}
+
+	var item models.Item
+	if err := database.DBClient.First(&item, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+	bidderID := middleware.CurrentUserID(c)
+	if !isOpenAuctionItem(item) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "この商品はオークション中ではありません"})
+		return
+	}
+	if item.SellerID == bidderID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "自分の商品には入札できません"})
+		return
+	}
+	if isBlockedBetween(item.SellerID, bidderID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "この商品には入札できません"})
+		return
+	}
+	// 落札時に既定の住所を配送先にするため、入札前に登録されていることを確認する
+	if _, err := resolveShippingAddress(bidderID, 0); err != nil {
+		respondShippingAddressError(c, err)
+		return
+	}
+
+	now := time.Now()
+	var auction models.Auction
+	var bid models.Bid
+	var notifications []models.Notification
+	extended := false
+	err := database.DBClient.Transaction(func(tx *gorm.DB) error {
+		// 💡 同時の入札で最低入札額の確認がずれないよう、オークションの行をロックしてから確認する
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("item_id = ? AND status = ?", item.ID, models.AuctionOpen).
+			First(&auction).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errAuctionClosed
+			}
+			return err
+		}
+		if !auction.EndsAt.After(now) {
+			return errAuctionClosed
+		}
+		if auction.HighestBidderID != nil && *auction.HighestBidderID == bidderID {
+			return errAlreadyHighestBidder
+		}
+		if req.Amount < minNextBid(auction) {
+			return errBidTooLow
+		}
+
+		bid = models.Bid{AuctionID: auction.ID, BidderID: bidderID, Amount: req.Amount}
+		if err := tx.Create(&bid).Error; err != nil {
+			return err
+		}
+		updates := map[string]interface{}{
+			"current_price":     req.Amount,
+			"highest_bidder_id": bidderID,
+			"bid_count":         gorm.Expr("bid_count + 1"),
+		}
+		// 💡 終了間際の入札は終了を延長し、締め切り直前の入札で他の入札者が応札できなくなるのを防ぐ
+		if endsAt, ok := extendAuctionEnd(auction.EndsAt, now); ok {
+			updates["ends_at"] = endsAt
+			extended = true
+		}
+		if err := tx.Model(&models.Auction{}).Where("id = ?", auction.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		// 一覧の表示と並び替えには現在価格を使う
+		if err := tx.Model(&models.Item{}).Where("id = ?", item.ID).Update("price", req.Amount).Error; err != nil {
+			return err
+		}
+
+		if auction.HighestBidderID != nil {
+			notifications = append(notifications, models.Notification{
+				UserID:    *auction.HighestBidderID,
+				Type:      "OUTBID",
+				Content:   fmt.Sprintf("「%s」でより高い%d円の入札がありました", item.Title, req.Amount),
+				RelatedID: item.ID,
+			})
+		}
+		notifications = append(notifications, models.Notification{
+			UserID:    item.SellerID,
+			Type:      "BID",
+			Content:   fmt.Sprintf("「%s」に%d円の入札がありました", item.Title, req.Amount),
+			RelatedID: item.ID,
+		})
+		if err := tx.Create(&notifications).Error; err != nil {
+			return err
+		}
+		return tx.First(&auction, auction.ID).Error
+	})
+	switch {
+	case err == nil:
+	case errors.Is(err, errAuctionClosed):
+		c.JSON(http.StatusConflict, gin.H{"error": "このオークションは終了しています"})
+		return
+	case errors.Is(err, errAlreadyHighestBidder):
+		c.JSON(http.StatusConflict, gin.H{"error": "既に最高額で入札しています"})
+		return
+	case errors.Is(err, errBidTooLow):
+		minBid := minNextBid(auction)
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%d円以上で入札してください", minBid), "min_next_bid": minBid})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to place bid"})
+		return
+	}
+	broadcastNotifications(notifications)
+
+	view := auctionView(auction, bidderID)
+	view["bid"] = bid
+	view["extended"] = extended
+	c.JSON(http.StatusCreated, view)
+}
+
+// StartAuctionCloser 終了日時を過ぎたオークションを interval ごとに締め切るバックグラウンド処理を開始する
+func StartAuctionCloser(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			closeDueAuctions()
+		}
+	}()
+}
+
+// closeDueAuctions 終了日時を過ぎたオークションを締め切る
+func closeDueAuctions() {
+	var auctions []models.Auction
+	if err := database.DBClient.
+		Where("status = ? AND ends_at <= ?", models.AuctionOpen, time.Now()).
+		Limit(100).
+		Find(&auctions).Error; err != nil {
+		log.Printf("Auction closer: failed to fetch due auctions: %v", err)
+		return
+	}
+
+	for _, auction := range auctions {
+		notifications, err := closeAuction(auction.ID)
+		switch {
+		case err == nil:
+			log.Printf("Auction closer: closed auction %d", auction.ID)
+		case errors.Is(err, errAuctionClosed), errors.Is(err, lifecycle.ErrConflict):
+			// 確認後に延長された、または他の処理が先に締め切った
+		default:
+			log.Printf("Auction closer: failed to close auction %d: %v", auction.ID, err)
+		}
+		broadcastNotifications(notifications)
+	}
+}
+
+// closeAuction オークションを締め切る
+// 最低落札価格に達した最高入札者がいれば商品を SOLD にして支払い待ちの取引を作成し、いなければ商品を下書きに戻す
+func closeAuction(auctionID uint64) ([]models.Notification, error) {
+	var notifications []models.Notification
+	err := database.DBClient.Transaction(func(tx *gorm.DB) error {
+		// 締め切りと同時の入札で延長された場合は締め切らない
+		var auction models.Auction
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND status = ? AND ends_at <= ?", auctionID, models.AuctionOpen, time.Now()).
+			First(&auction).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errAuctionClosed
+			}
+			return err
+		}
+
+		var item models.Item
+		if err := tx.First(&item, auction.ItemID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return tx.Model(&auction).Update("status", models.AuctionUnsold).Error
+			}
+			return err
+		}
+
+		if auction.ReserveMet() && isOpenAuctionItem(item) {
+			winnerID := *auction.HighestBidderID
+			if err := lifecycle.MoveWith(tx, &item, lifecycle.Sold, lifecycle.ActorSystem, map[string]interface{}{
+				"stock": gorm.Expr("stock - ?", 1),
+			}); err != nil {
+				return err
+			}
+			revision, err := recordItemRevision(tx, item.ID, item.SellerID)
+			if err != nil {
+				return err
+			}
+			// 落札時点の既定の住所を配送先にする (入札後に住所を削除した場合は空のまま)
+			address, err := resolveShippingAddress(winnerID, 0)
+			if err != nil && !errors.Is(err, errNoShippingAddress) {
+				return err
+			}
+			paymentDeadline := time.Now().Add(auctionPaymentWindow)
+			transaction := models.Transaction{
+				ItemID:          item.ID,
+				BuyerID:         winnerID,
+				SellerID:        item.SellerID,
+				PriceSnapshot:   auction.CurrentPrice,
+				Quantity:        1,
+				ItemRevisionID:  &revision.ID,
+				Status:          models.TransactionPaymentPending,
+				PaymentDeadline: &paymentDeadline,
+				ShippingAddress: address.Snapshot(),
+			}
+			if err := tx.Create(&transaction).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&auction).Updates(map[string]interface{}{
+				"status":         models.AuctionSold,
+				"transaction_id": transaction.ID,
+			}).Error; err != nil {
+				return err
+			}
+			notifications = []models.Notification{
+				{
+					UserID:    winnerID,
+					Type:      "AUCTION_WON",
+					Content:   fmt.Sprintf("「%s」を%d円で落札しました。%sまでに支払いを完了してください", item.Title, auction.CurrentPrice, paymentDeadline.Format("1月2日 15:04")),
+					RelatedID: transaction.ID,
+				},
+				{
+					UserID:    item.SellerID,
+					Type:      "AUCTION_SOLD",
+					Content:   fmt.Sprintf("「%s」が%d円で落札されました。落札者の支払いをお待ちください", item.Title, auction.CurrentPrice),
+					RelatedID: transaction.ID,
+				},
+			}
+		} else {
+			if err := tx.Model(&auction).Update("status", models.AuctionUnsold).Error; err != nil {
+				return err
+			}
+			// 入札で上がった価格は開始価格に戻し、出品者が出品し直せるよう下書きにする
+			if isOpenAuctionItem(item) {
+				if err := lifecycle.MoveWith(tx, &item, lifecycle.Draft, lifecycle.ActorSystem, map[string]interface{}{
+					"price":        auction.StartPrice,
+					"listing_type": models.ListingFixed,
+				}); err != nil {
+					return err
+				}
+			}
+			content := fmt.Sprintf("「%s」のオークションは入札がなく終了しました", item.Title)
+			if auction.BidCount > 0 {
+				content = fmt.Sprintf("「%s」のオークションは最低落札価格に達しなかったため落札されませんでした", item.Title)
+				notifications = append(notifications, models.Notification{
+					UserID:    *auction.HighestBidderID,
+					Type:      "AUCTION_UNSOLD",
+					Content:   content,
+					RelatedID: item.ID,
+				})
+			}
+			notifications = append(notifications, models.Notification{
+				UserID:    item.SellerID,
+				Type:      "AUCTION_UNSOLD",
+				Content:   content,
+				RelatedID: item.ID,
+			})
+		}
+		return tx.Create(&notifications).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+// loadPaymentPendingTransaction 落札者本人の支払い待ちの取引を取得する
+// 失敗時はレスポンスを書き込んで false を返す
+func loadPaymentPendingTransaction(c *gin.Context) (models.Transaction, bool) {
+	txID, err := strconv.ParseUint(c.Param("tx_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction ID"})
+		return models.Transaction{}, false
+	}
+	tx, role, ok := loadParticipantTransaction(c, txID)
+	if !ok {
+		return tx, false
+	}
+	if role != "BUYER" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "支払いができるのは落札者のみです"})
+		return tx, false
+	}
+	if tx.Status != models.TransactionPaymentPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "この取引は支払い待ちではありません"})
+		return tx, false
+	}
+	return tx, true
+}
+
+// CreateAuctionPaymentIntentHandler 落札代金の支払いインテントを作成 (POST /transactions/:tx_id/payment-intent)
+func CreateAuctionPaymentIntentHandler(c *gin.Context) {
+	tx, ok := loadPaymentPendingTransaction(c)
+	if !ok {
+		return
+	}
+	if tx.PaymentDeadline != nil && !tx.PaymentDeadline.After(time.Now()) {
+		c.JSON(http.StatusConflict, gin.H{"error": "支払い期限を過ぎています"})
+		return
+	}
+	configureStripe()
+
+	// 作成済みの支払いインテントがあれば同じものを返す (画面の再読み込みなど)
+	if tx.StripePaymentID != "" {
+		if pi, err := paymentintent.Get(tx.StripePaymentID, nil); err == nil && pi.Status != stripe.PaymentIntentStatusCanceled {
+			c.JSON(http.StatusOK, gin.H{"clientSecret": pi.ClientSecret})
+			return
+		}
+	}
+
+	params := &stripe.PaymentIntentParams{
+		Amount:   stripe.Int64(int64(tx.PriceSnapshot) * int64(tx.Quantity)),
+		Currency: stripe.String(string(stripe.CurrencyJPY)),
+		AutomaticPaymentMethods: &stripe.PaymentIntentAutomaticPaymentMethodsParams{
+			Enabled: stripe.Bool(true),
+		},
+	}
+	params.AddMetadata("transaction_id", strconv.FormatUint(tx.ID, 10))
+	params.AddMetadata("item_id", strconv.FormatUint(tx.ItemID, 10))
+	params.AddMetadata("buyer_id", strconv.FormatUint(tx.BuyerID, 10))
+
+	pi, err := paymentintent.New(params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment intent"})
+		return
+	}
+	// 取引に結びつけられない支払いインテントは確認できないため取り消す
+	if err := database.DBClient.Model(&models.Transaction{}).
+		Where("id = ? AND status = ?", tx.ID, models.TransactionPaymentPending).
+		Update("stripe_payment_id", pi.ID).Error; err != nil {
+		fmt.Printf("Auction Payment Intent Error: %v\n", err)
+		if _, err := paymentintent.Cancel(pi.ID, nil); err != nil {
+			fmt.Printf("Cancel Payment Intent Error: %v\n", err)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment intent"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"clientSecret": pi.ClientSecret})
+}
+
+// ConfirmAuctionPaymentHandler 落札代金の支払いを確認して取引を開始する (POST /transactions/:tx_id/confirm-payment)
+func ConfirmAuctionPaymentHandler(c *gin.Context) {
+	tx, ok := loadPaymentPendingTransaction(c)
+	if !ok {
+		return
+	}
+	if tx.StripePaymentID == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "支払いが開始されていません"})
+		return
+	}
+
+	configureStripe()
+	pi, err := paymentintent.Get(tx.StripePaymentID, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payment intent"})
+		return
+	}
+	if pi.Status != stripe.PaymentIntentStatusSucceeded {
+		c.JSON(http.StatusConflict, gin.H{"error": "支払いが完了していません", "payment_status": pi.Status})
+		return
+	}
+
+	result := database.DBClient.Model(&models.Transaction{}).
+		Where("id = ? AND status = ?", tx.ID, models.TransactionPaymentPending).
+		Update("status", "PURCHASED")
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update transaction"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Transaction status was changed. Please reload and try again"})
+		return
+	}
+
+	// 出品者への通知
+	database.DBClient.Preload("Item").First(&tx, tx.ID)
+	noti := models.Notification{
+		UserID:    tx.SellerID,
+		Type:      "SOLD",
+		Content:   fmt.Sprintf("「%s」の落札代金が支払われました。発送準備をお願いします", tx.Item.Title),
+		RelatedID: tx.ID,
+	}
+	database.DBClient.Create(&noti)
+	BroadcastNotification(tx.SellerID, noti)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Payment confirmed", "transaction_id": tx.ID})
+}
+
+// StartAuctionPaymentSweeper 支払い期限を過ぎた落札の取引を interval ごとにキャンセルするバックグラウンド処理を開始する
+func StartAuctionPaymentSweeper(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			expireUnpaidAuctions()
+		}
+	}()
+}
+
+// expireUnpaidAuctions 支払い期限を過ぎた支払い待ちの取引をキャンセルし、商品を出品者の下書きに戻す
+func expireUnpaidAuctions() {
+	var transactions []models.Transaction
+	if err := database.DBClient.
+		Where("status = ? AND payment_deadline <= ?", models.TransactionPaymentPending, time.Now()).
+		Limit(100).
+		Find(&transactions).Error; err != nil {
+		log.Printf("Auction payment sweeper: failed to fetch unpaid transactions: %v", err)
+		return
+	}
+
+	for _, transaction := range transactions {
+		notifications, err := cancelUnpaidAuction(transaction)
+		switch {
+		case err == nil:
+			log.Printf("Auction payment sweeper: canceled unpaid transaction %d", transaction.ID)
+			broadcastNotifications(notifications)
+		case errors.Is(err, errPaymentAlreadySucceeded):
+			// 期限直前に支払われた場合は、落札者の支払いの確認を待つ
+		case errors.Is(err, lifecycle.ErrConflict):
+			// 同時に支払い・キャンセルされた
+		default:
+			log.Printf("Auction payment sweeper: failed to cancel transaction %d: %v", transaction.ID, err)
+		}
+	}
+}
+
+// cancelUnpaidAuction 支払い待ちの取引を支払いインテントごとキャンセルし、商品を在庫に戻す
+func cancelUnpaidAuction(transaction models.Transaction) ([]models.Notification, error) {
+	if err := cancelAuctionPaymentIntent(transaction); err != nil {
+		return nil, err
+	}
+
+	var notifications []models.Notification
+	err := database.DBClient.Transaction(func(tx *gorm.DB) error {
+		// 確認後に新しい支払いインテントが作られていた場合はキャンセルしない
+		result := tx.Model(&models.Transaction{}).
+			Where("id = ? AND status = ? AND stripe_payment_id = ?", transaction.ID, models.TransactionPaymentPending, transaction.StripePaymentID).
+			Update("status", "CANCELED")
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return lifecycle.ErrConflict
+		}
+		if err := restockCanceledTransaction(tx, transaction); err != nil {
+			return err
+		}
+
+		var item models.Item
+		if err := tx.Unscoped().First(&item, transaction.ItemID).Error; err != nil {
+			return err
+		}
+		notifications = []models.Notification{
+			{
+				UserID:    transaction.BuyerID,
+				Type:      "AUCTION_PAYMENT_EXPIRED",
+				Content:   fmt.Sprintf("支払い期限を過ぎたため、「%s」の落札はキャンセルされました", item.Title),
+				RelatedID: transaction.ID,
+			},
+			{
+				UserID:    transaction.SellerID,
+				Type:      "AUCTION_PAYMENT_EXPIRED",
+				Content:   fmt.Sprintf("落札者が支払い期限までに支払わなかったため、「%s」の取引をキャンセルしました。商品は下書きに戻りました", item.Title),
+				RelatedID: transaction.ID,
+			},
+		}
+		return tx.Create(&notifications).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+// cancelAuctionPaymentIntent 支払い待ちの取引の支払いインテントを取り消す
+// 支払いが完了済み・処理中の場合は取り消さず errPaymentAlreadySucceeded を返す
+func cancelAuctionPaymentIntent(transaction models.Transaction) error {
+	if transaction.StripePaymentID == "" {
+		return nil
+	}
+	configureStripe()
+	pi, err := paymentintent.Get(transaction.StripePaymentID, nil)
+	if err != nil {
+		return fmt.Errorf("failed to fetch payment intent: %w", err)
+	}
+	switch pi.Status {
+	case stripe.PaymentIntentStatusSucceeded, stripe.PaymentIntentStatusProcessing:
+		return errPaymentAlreadySucceeded
+	case stripe.PaymentIntentStatusCanceled:
+		return nil
+	}
+	if _, err := paymentintent.Cancel(transaction.StripePaymentID, nil); err != nil {
+		return fmt.Errorf("failed to cancel payment intent: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Kousuke-irie/hackathon-backend/models"
+)
+
+func TestMinBidIncrement(t *testing.T) {
+	tests := []struct {
+		price int
+		want  int
+	}{
+		{0, 10},
+		{999, 10},
+		{1000, 100},
+		{4999, 100},
+		{5000, 250},
+		{9999, 250},
+		{10000, 500},
+		{49999, 500},
+		{50000, 1000},
+		{1000000, 1000},
+	}
+
+	for _, tt := range tests {
+		if got := minBidIncrement(tt.price); got != tt.want {
+			t.Errorf("minBidIncrement(%d) = %d, want %d", tt.price, got, tt.want)
+		}
+	}
+}
+
+func TestMinNextBid(t *testing.T) {
+	tests := []struct {
+		name    string
+		auction models.Auction
+		want    int
+	}{
+		{"first bid starts at start price", models.Auction{StartPrice: 3000, CurrentPrice: 3000}, 3000},
+		{"next bid adds increment", models.Auction{StartPrice: 3000, CurrentPrice: 3000, BidCount: 1}, 3100},
+		{"increment follows current price tier", models.Auction{StartPrice: 500, CurrentPrice: 9800, BidCount: 5}, 10050},
+		{"tier boundary uses higher increment", models.Auction{StartPrice: 500, CurrentPrice: 1000, BidCount: 2}, 1100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := minNextBid(tt.auction); got != tt.want {
+				t.Errorf("minNextBid() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtendAuctionEnd(t *testing.T) {
+	endsAt := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		bidAt    time.Time
+		want     time.Time
+		extended bool
+	}{
+		{"well before the window", endsAt.Add(-time.Hour), endsAt, false},
+		{"exactly at the window", endsAt.Add(-antiSnipeWindow), endsAt, false},
+		{"just inside the window", endsAt.Add(-antiSnipeWindow + time.Second), endsAt.Add(time.Second), true},
+		{"last second", endsAt.Add(-time.Second), endsAt.Add(antiSnipeWindow - time.Second), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, extended := extendAuctionEnd(endsAt, tt.bidAt)
+			if !got.Equal(tt.want) || extended != tt.extended {
+				t.Errorf("extendAuctionEnd() = (%v, %v), want (%v, %v)", got, extended, tt.want, tt.extended)
+			}
+		})
+	}
+}
@@ -1,16 +1,18 @@
 package handlers
 
 import (
-	"context"
 	"errors"
+	"log"
 	"net/http"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/Kousuke-irie/hackathon-backend/database"
 	"github.com/Kousuke-irie/hackathon-backend/firebase"
+	"github.com/Kousuke-irie/hackathon-backend/middleware"
 	"github.com/Kousuke-irie/hackathon-backend/models"
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
 type LoginRequest struct {
@@ -24,8 +26,8 @@ func LoginHandler(c *gin.Context) {
 		return
 	}
 
-	// 1. Firebaseでトークンを検証
-	token, err := firebase.AuthClient.VerifyIDToken(context.Background(), req.IDToken)
+	// 1. 設定された検証器 (Firebase またはローカル) でトークンを検証
+	token, err := firebase.Verifier.VerifyIDToken(c.Request.Context(), req.IDToken)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 		return
@@ -43,56 +45,114 @@ func LoginHandler(c *gin.Context) {
 
 	picture, _ := token.Claims["picture"].(string)
 	if picture == "" {
-		picture = "https://www.gravatar.com/avatar/00000000000000000000000000000000?d=mp&f=y" // デフォルトアイコン
+		picture = defaultIconURL // デフォルトアイコン
 	}
 
-	// 3. Upsert ロジック
-	var user models.User
-	db := database.DBClient
+	// 3. Upsert ロジック (メールアドレスによる既存アカウントへの紐付けは確認済みの場合のみ)
+	emailVerified, _ := token.Claims["email_verified"].(bool)
+	user, err := resolveLoginUser(loginProfile{
+		FirebaseUID:   firebaseUID,
+		Provider:      token.Firebase.SignInProvider,
+		Email:         email,
+		EmailVerified: emailVerified,
+		Name:          name,
+		Picture:       picture,
+	})
+	if errors.Is(err, errUnverifiedEmailConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "このメールアドレスは既に別のアカウントで使用されています。メールアドレスを確認してから再度ログインしてください"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error during login"})
+		return
+	}
 
-	result := db.Where("firebase_uid = ?", firebaseUID).First(&user)
-
-	if result.Error == nil {
-		// 既存ユーザーの更新（ログインごとに最新情報を反映）
-		user.Email = email
-		if user.Username == "" {
-			user.Username = name
-		} // 名前がなければ更新
-		db.Save(&user)
-	} else if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-		// メアドで既存ユーザーを検索（UID未紐付け対策）
-		emailResult := db.Where("email = ?", email).First(&user)
-
-		if emailResult.Error == nil {
-			user.FirebaseUID = firebaseUID
-			user.Email = email
-			if user.Username == "" {
-				user.Username = name
-			}
-			db.Save(&user)
-		} else if errors.Is(emailResult.Error, gorm.ErrRecordNotFound) {
-			// 完全新規作成
-			user = models.User{
-				FirebaseUID: firebaseUID,
-				Email:       email,
-				Username:    name,
-				IconURL:     picture,
-			}
-			if err := db.Create(&user).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create new user"})
-				return
-			}
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error during email check"})
-			return
-		}
-	} else {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error during UID check"})
+	// 4. 初回の管理者をブートストラップ
+	if err := bootstrapAdmin(user, emailVerified); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to bootstrap admin"})
+		return
+	}
+
+	// 5. 独自のセッションを発行 (以降のAPIはこのアクセストークンで認証する)
+	tokens, err := issueSession(c, uint64(user.ID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Login successful",
-		"user":    user,
+		"user":    user.Self(),
+		"tokens":  tokens,
 	})
 }
+
+// rejectForeignActor リクエストボディで指定された操作者IDが呼び出し元と異なる場合に 403 を返す
+// 旧クライアント互換のため、IDが省略 (0) されている場合はそのまま許可する
+func rejectForeignActor(c *gin.Context, claimedID uint64) bool {
+	if claimedID != 0 && claimedID != middleware.CurrentUserID(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot act on behalf of another user"})
+		return true
+	}
+	return false
+}
+
+// IssueDevIDTokenHandler 開発用IDトークンを発行する (AUTH_PROVIDER=local の場合のみ有効)
+// 発行したトークンを /login に渡すと、通常どおりセッションが発行される
+func IssueDevIDTokenHandler(c *gin.Context) {
+	local, ok := firebase.Local()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Local auth is disabled"})
+		return
+	}
+
+	var req struct {
+		UID           string `json:"uid" binding:"required"`
+		Email         string `json:"email" binding:"required"`
+		Name          string `json:"name"`
+		EmailVerified bool   `json:"email_verified"`
+		Provider      string `json:"sign_in_provider"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "uid and email are required"})
+		return
+	}
+
+	idToken, err := local.IssueIDToken(req.UID, map[string]interface{}{
+		"email":            req.Email,
+		"name":             req.Name,
+		"email_verified":   req.EmailVerified,
+		"sign_in_provider": req.Provider,
+	}, time.Hour)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id_token": idToken})
+}
+
+// bootstrapAdmin BOOTSTRAP_ADMIN_EMAIL と一致する確認済みメールアドレスのユーザーを管理者に昇格する
+// 管理者が一人もいない場合のみ有効で、以降の昇格は /admin から行う
+func bootstrapAdmin(user *models.User, emailVerified bool) error {
+	bootstrapEmail := os.Getenv("BOOTSTRAP_ADMIN_EMAIL")
+	if bootstrapEmail == "" || !emailVerified || user.Role == models.RoleAdmin ||
+		!strings.EqualFold(bootstrapEmail, user.Email) {
+		return nil
+	}
+
+	db := database.DBClient
+	var adminCount int64
+	if err := db.Model(&models.User{}).Where("role = ?", models.RoleAdmin).Count(&adminCount).Error; err != nil {
+		return err
+	}
+	if adminCount > 0 {
+		return nil
+	}
+
+	if err := db.Model(user).Update("role", models.RoleAdmin).Error; err != nil {
+		return err
+	}
+	log.Printf("Bootstrap admin promoted: user_id=%d", user.ID)
+	return nil
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Kousuke-irie/hackathon-backend/database"
+	"github.com/Kousuke-irie/hackathon-backend/middleware"
+	"github.com/Kousuke-irie/hackathon-backend/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// isBlockedBetween どちらか一方が相手をブロックしているかを返す
+func isBlockedBetween(a, b uint64) bool {
+	if a == 0 || b == 0 {
+		return false
+	}
+	var count int64
+	database.DBClient.Model(&models.UserBlock{}).
+		Where("type = ? AND ((user_id = ? AND target_id = ?) OR (user_id = ? AND target_id = ?))", models.BlockTypeBlock, a, b, b, a).
+		Count(&count)
+	return count > 0
+}
+
+// hasMuted userID が targetID をミュートまたはブロックしているかを返す (通知の抑制に使う)
+func hasMuted(userID, targetID uint64) bool {
+	var count int64
+	database.DBClient.Model(&models.UserBlock{}).
+		Where("user_id = ? AND target_id = ?", userID, targetID).
+		Count(&count)
+	return count > 0
+}
+
+// excludeHiddenUsers 閲覧者がブロック・ミュートした相手と、閲覧者をブロックした相手を column から除外する
+func excludeHiddenUsers(query *gorm.DB, column string, viewerID uint64) *gorm.DB {
+	if viewerID == 0 {
+		return query
+	}
+	return query.
+		Where(column+" NOT IN (SELECT target_id FROM user_blocks WHERE user_id = ?)", viewerID).
+		Where(column+" NOT IN (SELECT user_id FROM user_blocks WHERE target_id = ? AND type = ?)", viewerID, models.BlockTypeBlock)
+}
+
+// parseBlockTarget パスの :id を相手ユーザーとして検証する
+func parseBlockTarget(c *gin.Context) (uint64, bool) {
+	targetID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return 0, false
+	}
+	if targetID == middleware.CurrentUserID(c) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "自分自身は指定できません"})
+		return 0, false
+	}
+	var count int64
+	database.DBClient.Model(&models.User{}).Where("id = ?", targetID).Count(&count)
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return 0, false
+	}
+	return targetID, true
+}
+
+// BlockUserHandler ユーザーをブロック (POST /users/:id/block)
+// 双方向のフォロー関係も解除する
+func BlockUserHandler(c *gin.Context) {
+	targetID, ok := parseBlockTarget(c)
+	if !ok {
+		return
+	}
+	userID := middleware.CurrentUserID(c)
+
+	err := database.DBClient.Transaction(func(tx *gorm.DB) error {
+		block := models.UserBlock{UserID: userID, TargetID: targetID, Type: models.BlockTypeBlock}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&block).Error; err != nil {
+			return err
+		}
+		return removeFollowsBetween(tx, userID, targetID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to block user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "blocked"})
+}
+
+// UnblockUserHandler ブロックを解除 (DELETE /users/:id/block)
+func UnblockUserHandler(c *gin.Context) {
+	removeUserBlock(c, models.BlockTypeBlock, "unblocked")
+}
+
+// MuteUserHandler ユーザーをミュート (POST /users/:id/mute)
+func MuteUserHandler(c *gin.Context) {
+	targetID, ok := parseBlockTarget(c)
+	if !ok {
+		return
+	}
+
+	mute := models.UserBlock{UserID: middleware.CurrentUserID(c), TargetID: targetID, Type: models.BlockTypeMute}
+	if err := database.DBClient.Clauses(clause.OnConflict{DoNothing: true}).Create(&mute).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mute user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "muted"})
+}
+
+// UnmuteUserHandler ミュートを解除 (DELETE /users/:id/mute)
+func UnmuteUserHandler(c *gin.Context) {
+	removeUserBlock(c, models.BlockTypeMute, "unmuted")
+}
+
+func removeUserBlock(c *gin.Context, blockType, status string) {
+	if err := database.DBClient.
+		Where("user_id = ? AND target_id = ? AND type = ?", middleware.CurrentUserID(c), c.Param("id"), blockType).
+		Delete(&models.UserBlock{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user relation"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": status})
+}
+
+// GetMyBlocksHandler 自分がブロック・ミュートしているユーザー一覧 (GET /my/blocks)
+func GetMyBlocksHandler(c *gin.Context) {
+	var blocks []models.UserBlock
+	if err := database.DBClient.Preload("Target").
+		Where("user_id = ?", middleware.CurrentUserID(c)).
+		Order("created_at DESC").
+		Find(&blocks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch blocks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"blocks": blocks})
+}
+
+// removeFollowsBetween 2人の間のフォロー関係を双方向とも削除し、カウントを補正する
+func removeFollowsBetween(tx *gorm.DB, a, b uint64) error {
+	var follows []models.Follow
+	if err := tx.Where("(follower_id = ? AND following_id = ?) OR (follower_id = ? AND following_id = ?)", a, b, b, a).
+		Find(&follows).Error; err != nil {
+		return err
+	}
+	for _, f := range follows {
+		if err := tx.Delete(&f).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.User{}).Where("id = ?", f.FollowerID).
+			UpdateColumn("following_count", gorm.Expr("GREATEST(following_count - 1, 0)")).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.User{}).Where("id = ?", f.FollowingID).
+			UpdateColumn("follower_count", gorm.Expr("GREATEST(follower_count - 1, 0)")).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"strconv"
 
 	"github.com/Kousuke-irie/hackathon-backend/database"
+	"github.com/Kousuke-irie/hackathon-backend/middleware"
 	"github.com/Kousuke-irie/hackathon-backend/models"
 	"github.com/gin-gonic/gin"
 )
@@ -15,8 +16,9 @@ func GetCommentsHandler(c *gin.Context) {
 	itemID := c.Param("id")
 
 	var comments []models.Comment
-	// 投稿したユーザーの情報も一緒に取得 (Preload)
-	if err := database.DBClient.Preload("User").Where("item_id = ?", itemID).Find(&comments).Error; err != nil {
+	// 投稿したユーザーの情報も一緒に取得 (Preload)。ブロック・ミュートした相手のコメントは表示しない
+	query := excludeHiddenUsers(database.DBClient.Preload("User").Where("item_id = ?", itemID), "user_id", middleware.CurrentUserID(c))
+	if err := query.Find(&comments).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch comments"})
 		return
 	}
@@ -30,7 +32,7 @@ func PostCommentHandler(c *gin.Context) {
 	itemID, _ := strconv.ParseUint(itemIDStr, 10, 64)
 
 	var req struct {
-		UserID  uint64 `json:"user_id"`
+		UserID  uint64 `json:"user_id"` // 省略可。ログインユーザー以外は指定不可
 		Content string `json:"content"`
 	}
 
@@ -39,9 +41,25 @@ func PostCommentHandler(c *gin.Context) {
 		return
 	}
 
+	if rejectForeignActor(c, req.UserID) {
+		return
+	}
+	userID := middleware.CurrentUserID(c)
+
+	var item models.Item
+	if err := database.DBClient.First(&item, itemID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+	// 出品者とブロック関係にある場合はコメントできない
+	if isBlockedBetween(userID, item.SellerID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "この商品にはコメントできません"})
+		return
+	}
+
 	newComment := models.Comment{
 		ItemID:  itemID,
-		UserID:  req.UserID,
+		UserID:  userID,
 		Content: req.Content,
 	}
 
@@ -56,11 +74,8 @@ func PostCommentHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"comment": newComment})
 
 	// 通知の作成と送信
-	var item models.Item
-	database.DBClient.First(&item, newComment.ItemID)
-
-	// 自分の商品へのコメントでない場合のみ通知
-	if item.SellerID != req.UserID {
+	// 自分の商品へのコメントでなく、出品者がミュートしていない場合のみ通知
+	if item.SellerID != userID && !hasMuted(item.SellerID, userID) {
 		noti := models.Notification{
 			UserID:    item.SellerID,
 			Type:      "COMMENT",
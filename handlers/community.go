@@ -1,11 +1,11 @@
 package handlers
 
 import (
-	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/Kousuke-irie/hackathon-backend/database"
+	"github.com/Kousuke-irie/hackathon-backend/middleware"
 	"github.com/Kousuke-irie/hackathon-backend/models"
 	"github.com/gin-gonic/gin"
 )
@@ -26,18 +26,22 @@ func CreateCommunityHandler(c *gin.Context) {
 		Name        string `json:"name"`
 		Description string `json:"description"`
 		ImageURL    string `json:"image_url"`
-		CreatorID   uint64 `json:"creator_id"`
+		CreatorID   uint64 `json:"creator_id"` // 省略可。ログインユーザー以外は指定不可
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
 
+	if rejectForeignActor(c, req.CreatorID) {
+		return
+	}
+
 	newComm := models.Community{
 		Name:        req.Name,
 		Description: req.Description,
 		ImageURL:    req.ImageURL,
-		CreatorID:   req.CreatorID,
+		CreatorID:   middleware.CurrentUserID(c),
 	}
 
 	if err := database.DBClient.Create(&newComm).Error; err != nil {
@@ -72,7 +76,7 @@ func PostToCommunityHandler(c *gin.Context) {
 	communityID, _ := strconv.ParseUint(communityIDStr, 10, 64)
 
 	var req struct {
-		UserID        uint64  `json:"user_id"`
+		UserID        uint64  `json:"user_id"` // 省略可。ログインユーザー以外は指定不可
 		Content       string  `json:"content"`
 		RelatedItemID *uint64 `json:"related_item_id"` // 商品ID（任意）
 	}
@@ -81,9 +85,14 @@ func PostToCommunityHandler(c *gin.Context) {
 		return
 	}
 
+	if rejectForeignActor(c, req.UserID) {
+		return
+	}
+	userID := middleware.CurrentUserID(c)
+
 	newPost := models.CommunityPost{
 		CommunityID:   communityID,
-		UserID:        req.UserID,
+		UserID:        userID,
 		Content:       req.Content,
 		RelatedItemID: req.RelatedItemID,
 	}
@@ -99,7 +108,7 @@ func PostToCommunityHandler(c *gin.Context) {
 	// 直近でその界隈に投稿したユーザーを取得（自分以外）
 	var recentPosters []uint64
 	database.DBClient.Model(&models.CommunityPost{}).
-		Where("community_id = ? AND user_id != ?", communityID, req.UserID).
+		Where("community_id = ? AND user_id != ?", communityID, userID).
 		Order("created_at desc").
 		Limit(5).
 		Pluck("user_id", &recentPosters)
@@ -126,7 +135,7 @@ func PostToCommunityHandler(c *gin.Context) {
 // UpdateCommunityHandler コミュニティ情報の更新
 func UpdateCommunityHandler(c *gin.Context) {
 	id := c.Param("id")
-	userID := c.GetHeader("X-User-ID")
+	userID := middleware.CurrentUserID(c)
 
 	var comm models.Community
 	if err := database.DBClient.First(&comm, id).Error; err != nil {
@@ -134,7 +143,7 @@ func UpdateCommunityHandler(c *gin.Context) {
 		return
 	}
 
-	if fmt.Sprintf("%d", comm.CreatorID) != userID {
+	if comm.CreatorID != userID {
 		c.JSON(http.StatusForbidden, gin.H{"error": "作成者のみが編集できます"})
 		return
 	}
@@ -163,7 +172,7 @@ func UpdateCommunityHandler(c *gin.Context) {
 
 func DeleteCommunityHandler(c *gin.Context) {
 	id := c.Param("id")
-	userIDStr := c.GetHeader("X-User-ID")
+	userID := middleware.CurrentUserID(c)
 
 	var comm models.Community
 	if err := database.DBClient.First(&comm, id).Error; err != nil {
@@ -171,7 +180,7 @@ func DeleteCommunityHandler(c *gin.Context) {
 		return
 	}
 
-	if fmt.Sprintf("%d", comm.CreatorID) != userIDStr {
+	if comm.CreatorID != userID {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Only the creator can delete this community"})
 		return
 	}
@@ -2,16 +2,16 @@ package handlers
 
 import (
 	"net/http"
-	"strconv"
 
 	"github.com/Kousuke-irie/hackathon-backend/database"
+	"github.com/Kousuke-irie/hackathon-backend/middleware"
 	"github.com/Kousuke-irie/hackathon-backend/models"
 	"github.com/gin-gonic/gin"
 )
 
 // GetChatHistoryHandler 特定の相手とのチャット履歴取得
 func GetChatHistoryHandler(c *gin.Context) {
-	myID := c.GetHeader("X-User-ID")
+	myID := middleware.CurrentUserID(c)
 	targetID := c.Param("userId")
 
 	var messages []models.Message
@@ -25,7 +25,7 @@ func GetChatHistoryHandler(c *gin.Context) {
 
 // GetChatThreadsHandler メッセージスレッド一覧（最新メッセージ付き）を取得
 func GetChatThreadsHandler(c *gin.Context) {
-	myID, _ := strconv.ParseUint(c.GetHeader("X-User-ID"), 10, 64)
+	myID := middleware.CurrentUserID(c)
 
 	// 最新のメッセージをユーザーごとに抽出する複雑なクエリの簡略版
 	var threads []struct {
@@ -0,0 +1,553 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Kousuke-irie/hackathon-backend/database"
+	"github.com/Kousuke-irie/hackathon-backend/firebase"
+	"github.com/Kousuke-irie/hackathon-backend/middleware"
+	"github.com/Kousuke-irie/hackathon-backend/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 監査ログのアクション (AccountAuditLog.Action)
+const (
+	auditLinkByEmail = "LINK_BY_EMAIL"
+	auditLink        = "LINK"
+	auditUnlink      = "UNLINK"
+	auditMerge       = "MERGE"
+)
+
+var errUnverifiedEmailConflict = errors.New("email is used by another account and is not verified")
+
+// loginProfile 検証済みIDトークンから取り出したログイン情報
+type loginProfile struct {
+	FirebaseUID   string
+	Provider      string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+}
+
+// resolveLoginUser ログインしたFirebaseアカウントに対応するユーザーを検索・作成する
+// 未連携のFirebaseアカウントを同じメールアドレスの既存ユーザーに紐付けるのは、メールアドレス確認済みの場合のみ
+func resolveLoginUser(p loginProfile) (*models.User, error) {
+	db := database.DBClient
+	var user models.User
+
+	// 1. 連携済みのログイン手段から検索
+	var identity models.UserIdentity
+	err := db.Where("firebase_uid = ?", p.FirebaseUID).First(&identity).Error
+	if err == nil {
+		if err := db.First(&user, identity.UserID).Error; err != nil {
+			return nil, err
+		}
+		return &user, refreshLoginProfile(db, &user, p)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	// 2. 連携記録のない既存ユーザー (users.firebase_uid のみ) は記録を補完する
+	err = db.Where("firebase_uid = ?", p.FirebaseUID).First(&user).Error
+	if err == nil {
+		if err := createIdentity(db, uint64(user.ID), p); err != nil {
+			return nil, err
+		}
+		return &user, refreshLoginProfile(db, &user, p)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	// 3. メールアドレスが一致する既存ユーザー
+	if p.Email != "" {
+		err = db.Where("email = ?", p.Email).First(&user).Error
+		if err == nil {
+			if !p.EmailVerified {
+				return nil, errUnverifiedEmailConflict
+			}
+			err = db.Transaction(func(tx *gorm.DB) error {
+				if err := createIdentity(tx, uint64(user.ID), p); err != nil {
+					return err
+				}
+				return recordAccountAudit(tx, uint64(user.ID), uint64(user.ID), auditLinkByEmail,
+					fmt.Sprintf("provider=%s email=%s", p.Provider, p.Email))
+			})
+			if err != nil {
+				return nil, err
+			}
+			return &user, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	// 4. 完全新規作成
+	user = models.User{
+		FirebaseUID: p.FirebaseUID,
+		Email:       p.Email,
+		Username:    p.Name,
+		IconURL:     p.Picture,
+		Role:        models.RoleUser,
+		Privacy:     models.DefaultPrivacySettings(),
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return createIdentity(tx, uint64(user.ID), p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// refreshLoginProfile ログインごとに最新情報を反映する
+// メールアドレスは主のログイン手段 (users.firebase_uid) でログインした場合のみ更新する
+// 💡 権限・公開範囲などを上書きしないよう、変わった項目だけを更新する
+func refreshLoginProfile(db *gorm.DB, user *models.User, p loginProfile) error {
+	updates := map[string]interface{}{}
+	if user.FirebaseUID == p.FirebaseUID && p.Email != "" && p.Email != user.Email {
+		// 他のユーザーが使っているメールアドレスには変更しない
+		var count int64
+		if err := db.Model(&models.User{}).Where("email = ? AND id <> ?", p.Email, user.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			updates["email"] = p.Email
+		}
+	}
+	if user.Username == "" && p.Name != "" {
+		updates["username"] = p.Name
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+
+	err := db.Model(&models.User{}).Where("id = ?", user.ID).Updates(updates).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		// 確認と更新の間に他のユーザーが同じメールアドレスになった場合は、メールアドレス以外を反映する
+		delete(updates, "email")
+		if len(updates) == 0 {
+			return nil
+		}
+		err = db.Model(&models.User{}).Where("id = ?", user.ID).Updates(updates).Error
+	}
+	if err != nil {
+		return err
+	}
+	if email, ok := updates["email"].(string); ok {
+		user.Email = email
+	}
+	if username, ok := updates["username"].(string); ok {
+		user.Username = username
+	}
+	return nil
+}
+
+func createIdentity(db *gorm.DB, userID uint64, p loginProfile) error {
+	return db.Create(&models.UserIdentity{
+		UserID:      userID,
+		FirebaseUID: p.FirebaseUID,
+		Provider:    p.Provider,
+		Email:       p.Email,
+	}).Error
+}
+
+func recordAccountAudit(db *gorm.DB, userID, actorID uint64, action, detail string) error {
+	return db.Create(&models.AccountAuditLog{
+		UserID:  userID,
+		ActorID: actorID,
+		Action:  action,
+		Detail:  detail,
+	}).Error
+}
+
+// GetIdentitiesHandler 自分に連携されているログイン手段の一覧を取得
+func GetIdentitiesHandler(c *gin.Context) {
+	var identities []models.UserIdentity
+	if err := database.DBClient.Where("user_id = ?", middleware.CurrentUserID(c)).
+		Order("created_at ASC").
+		Find(&identities).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch identities"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"identities": identities})
+}
+
+type otherAccountRequest struct {
+	IDToken string `json:"id_token" binding:"required"` // 連携・統合するアカウントのIDトークン (所有の証明)
+}
+
+// verifyOtherAccount リクエストのIDトークンを検証し、そのアカウントのログイン情報を返す
+func verifyOtherAccount(c *gin.Context) (loginProfile, bool) {
+	var req otherAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id_token is required"})
+		return loginProfile{}, false
+	}
+
+	token, err := firebase.Verifier.VerifyIDToken(c.Request.Context(), req.IDToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return loginProfile{}, false
+	}
+
+	email, _ := token.Claims["email"].(string)
+	emailVerified, _ := token.Claims["email_verified"].(bool)
+	return loginProfile{
+		FirebaseUID:   token.UID,
+		Provider:      token.Firebase.SignInProvider,
+		Email:         email,
+		EmailVerified: emailVerified,
+	}, true
+}
+
+// findIdentityOwner Firebase UID を使っているユーザーIDを返す。未使用なら 0
+func findIdentityOwner(db *gorm.DB, firebaseUID string) (uint64, error) {
+	var identity models.UserIdentity
+	err := db.Where("firebase_uid = ?", firebaseUID).First(&identity).Error
+	if err == nil {
+		return identity.UserID, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, err
+	}
+
+	var user models.User
+	err = db.Where("firebase_uid = ?", firebaseUID).First(&user).Error
+	if err == nil {
+		return uint64(user.ID), nil
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	return 0, err
+}
+
+// LinkIdentityHandler 別のログイン手段を自分のアカウントに連携する (POST /users/me/identities)
+func LinkIdentityHandler(c *gin.Context) {
+	p, ok := verifyOtherAccount(c)
+	if !ok {
+		return
+	}
+	userID := middleware.CurrentUserID(c)
+	db := database.DBClient
+
+	ownerID, err := findIdentityOwner(db, p.FirebaseUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link identity"})
+		return
+	}
+	if ownerID == userID {
+		c.JSON(http.StatusConflict, gin.H{"error": "This identity is already linked to your account"})
+		return
+	}
+	if ownerID != 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "This identity belongs to another account. Use account merge instead"})
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := createIdentity(tx, userID, p); err != nil {
+			return err
+		}
+		return recordAccountAudit(tx, userID, userID, auditLink, fmt.Sprintf("provider=%s email=%s", p.Provider, p.Email))
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link identity"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Identity linked"})
+}
+
+// UnlinkIdentityHandler ログイン手段の連携を解除する (DELETE /users/me/identities/:id)
+// 最後のログイン手段は解除できない
+func UnlinkIdentityHandler(c *gin.Context) {
+	identityID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid identity ID"})
+		return
+	}
+	userID := middleware.CurrentUserID(c)
+	db := database.DBClient
+
+	var identity models.UserIdentity
+	if err := db.Where("id = ? AND user_id = ?", identityID, userID).First(&identity).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Identity not found"})
+		return
+	}
+
+	var remaining []models.UserIdentity
+	db.Where("user_id = ? AND id != ?", userID, identityID).Order("created_at ASC").Find(&remaining)
+	if len(remaining) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot unlink your last sign-in method"})
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&identity).Error; err != nil {
+			return err
+		}
+		// 主のログイン手段を解除した場合は、残っている最も古いものを主にする
+		if err := tx.Model(&models.User{}).
+			Where("id = ? AND firebase_uid = ?", userID, identity.FirebaseUID).
+			Update("firebase_uid", remaining[0].FirebaseUID).Error; err != nil {
+			return err
+		}
+		return recordAccountAudit(tx, userID, userID, auditUnlink, fmt.Sprintf("provider=%s email=%s", identity.Provider, identity.Email))
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink identity"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Identity unlinked"})
+}
+
+// MergeAccountHandler 自分が所有する別アカウントを現在のアカウントに統合する (POST /users/me/merge)
+// 統合元のデータ (出品・取引・フォローなど) を移し替え、統合元は退会済みとして匿名化する
+func MergeAccountHandler(c *gin.Context) {
+	p, ok := verifyOtherAccount(c)
+	if !ok {
+		return
+	}
+	targetID := middleware.CurrentUserID(c)
+	db := database.DBClient
+
+	sourceID, err := findIdentityOwner(db, p.FirebaseUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to merge accounts"})
+		return
+	}
+	if sourceID == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No account is associated with this identity. Link it instead"})
+		return
+	}
+	if sourceID == targetID {
+		c.JSON(http.StatusConflict, gin.H{"error": "This identity is already linked to your account"})
+		return
+	}
+
+	// 💡 2つのアカウント間の取引は、統合すると購入者と出品者が同一になるため統合できない
+	var mutualTxCount, mutualOrderCount int64
+	if err := db.Model(&models.Transaction{}).
+		Where("(buyer_id = ? AND seller_id = ?) OR (buyer_id = ? AND seller_id = ?)", sourceID, targetID, targetID, sourceID).
+		Count(&mutualTxCount).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to merge accounts"})
+		return
+	}
+	if err := db.Model(&models.Order{}).
+		Where("(buyer_id = ? AND seller_id = ?) OR (buyer_id = ? AND seller_id = ?)", sourceID, targetID, targetID, sourceID).
+		Count(&mutualOrderCount).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to merge accounts"})
+		return
+	}
+	if mutualTxCount > 0 || mutualOrderCount > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Accounts that have traded with each other cannot be merged"})
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := mergeAccountData(tx, sourceID, targetID); err != nil {
+			return err
+		}
+		if err := anonymizeUser(tx, sourceID); err != nil {
+			return err
+		}
+		detail := fmt.Sprintf("merged user_id=%d into user_id=%d", sourceID, targetID)
+		if err := recordAccountAudit(tx, targetID, targetID, auditMerge, detail); err != nil {
+			return err
+		}
+		return recordAccountAudit(tx, sourceID, targetID, auditMerge, detail)
+	})
+	if err != nil {
+		fmt.Printf("Account Merge Error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to merge accounts"})
+		return
+	}
+
+	var user models.User
+	db.First(&user, targetID)
+	c.JSON(http.StatusOK, gin.H{"message": "Accounts merged", "user": user.Self()})
+}
+
+// mergeAccountData 統合元ユーザーのデータを統合先ユーザーに付け替える
+func mergeAccountData(tx *gorm.DB, sourceID, targetID uint64) error {
+	// 2つのアカウント間のメッセージは自分宛てになるため削除する
+	if err := tx.Where("(sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?)",
+		sourceID, targetID, targetID, sourceID).Delete(&models.Message{}).Error; err != nil {
+		return err
+	}
+
+	// 2つのアカウント間の値下げ交渉は自分との交渉になるため削除する
+	if err := tx.Where("(buyer_id = ? AND seller_id = ?) OR (buyer_id = ? AND seller_id = ?)",
+		sourceID, targetID, targetID, sourceID).Delete(&models.Offer{}).Error; err != nil {
+		return err
+	}
+
+	// 統合元の住所は統合先の既定の住所を上書きしないよう、既定を外してから付け替える
+	if err := tx.Model(&models.Address{}).Where("user_id = ?", sourceID).Update("is_default", false).Error; err != nil {
+		return err
+	}
+
+	// まとめ買いの送料ルールは統合先に設定がなければ引き継ぐ
+	var targetRuleCount int64
+	if err := tx.Model(&models.ShippingRule{}).Where("seller_id = ?", targetID).Count(&targetRuleCount).Error; err != nil {
+		return err
+	}
+	if targetRuleCount > 0 {
+		if err := tx.Where("seller_id = ?", sourceID).Delete(&models.ShippingRule{}).Error; err != nil {
+			return err
+		}
+	}
+
+	reassign := []struct {
+		Model  interface{}
+		Column string
+	}{
+		{&models.UserIdentity{}, "user_id"},
+		{&models.Address{}, "user_id"},
+		{&models.SellerVerification{}, "user_id"},
+		{&models.Item{}, "seller_id"},
+		{&models.Item{}, "reserved_by_id"}, // 統合元で購入手続き中の予約
+		{&models.ItemRevision{}, "editor_id"},
+		{&models.Transaction{}, "buyer_id"},
+		{&models.Transaction{}, "seller_id"},
+		{&models.Order{}, "buyer_id"},
+		{&models.Order{}, "seller_id"},
+		{&models.ShippingRule{}, "seller_id"},
+		{&models.Offer{}, "buyer_id"},
+		{&models.Offer{}, "seller_id"},
+		{&models.Auction{}, "seller_id"},
+		{&models.Auction{}, "highest_bidder_id"},
+		{&models.Bid{}, "bidder_id"},
+		{&models.ItemDailyStat{}, "seller_id"},
+		{&models.Comment{}, "user_id"},
+		{&models.Community{}, "creator_id"},
+		{&models.CommunityPost{}, "user_id"},
+		{&models.Review{}, "rater_id"},
+		{&models.Notification{}, "user_id"},
+		{&models.ViewHistory{}, "user_id"},
+		{&models.Message{}, "sender_id"},
+		{&models.Message{}, "receiver_id"},
+	}
+
+	for _, r := range reassign {
+		// 論理削除した商品も統合先に付け替える
+		if err := tx.Unscoped().Model(r.Model).Where(r.Column+" = ?", sourceID).Update(r.Column, targetID).Error; err != nil {
+			return err
+		}
+	}
+
+	if err := mergeLikes(tx, sourceID, targetID); err != nil {
+		return err
+	}
+	if err := mergeStockHolds(tx, sourceID, targetID); err != nil {
+		return err
+	}
+	if err := mergeBlocks(tx, sourceID, targetID); err != nil {
+		return err
+	}
+	return mergeFollows(tx, sourceID, targetID)
+}
+
+// mergeStockHolds 在庫の確保を付け替える。同じ商品を両方が確保している場合は統合元の確保を残し、期限切れで在庫に戻す
+func mergeStockHolds(tx *gorm.DB, sourceID, targetID uint64) error {
+	return tx.Exec(`
+		UPDATE stock_holds AS h
+		LEFT JOIN stock_holds AS t ON t.buyer_id = ? AND t.item_id = h.item_id
+		SET h.buyer_id = ?
+		WHERE h.buyer_id = ? AND t.id IS NULL`, targetID, targetID, sourceID).Error
+}
+
+// mergeLikes スワイプ履歴を付け替える。同じ商品へのスワイプが両方にある場合は統合先の記録を残す
+func mergeLikes(tx *gorm.DB, sourceID, targetID uint64) error {
+	if err := tx.Exec(`
+		DELETE l FROM likes AS l
+		JOIN likes AS t ON t.user_id = ? AND t.item_id = l.item_id
+		WHERE l.user_id = ?`, targetID, sourceID).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.Like{}).Where("user_id = ?", sourceID).Update("user_id", targetID).Error
+}
+
+// mergeBlocks ブロック・ミュートを付け替える。2つのアカウント間のものと、統合先と重複するものは削除する
+func mergeBlocks(tx *gorm.DB, sourceID, targetID uint64) error {
+	if err := tx.Where("(user_id = ? AND target_id = ?) OR (user_id = ? AND target_id = ?)",
+		sourceID, targetID, targetID, sourceID).Delete(&models.UserBlock{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Exec(`
+		DELETE b FROM user_blocks AS b
+		JOIN user_blocks AS t ON t.user_id = ? AND t.target_id = b.target_id AND t.type = b.type
+		WHERE b.user_id = ?`, targetID, sourceID).Error; err != nil {
+		return err
+	}
+	if err := tx.Exec(`
+		DELETE b FROM user_blocks AS b
+		JOIN user_blocks AS t ON t.target_id = ? AND t.user_id = b.user_id AND t.type = b.type
+		WHERE b.target_id = ?`, targetID, sourceID).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.UserBlock{}).Where("user_id = ?", sourceID).Update("user_id", targetID).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.UserBlock{}).Where("target_id = ?", sourceID).Update("target_id", targetID).Error
+}
+
+// mergeFollows フォロー関係を付け替え、重複を除いてからフォロー数を再集計する
+func mergeFollows(tx *gorm.DB, sourceID, targetID uint64) error {
+	// フォロー数を再集計するユーザー (統合先と、統合元のフォロー・フォロワー)
+	var sourceFollowing, sourceFollowers []uint64
+	tx.Model(&models.Follow{}).Where("follower_id = ?", sourceID).Pluck("following_id", &sourceFollowing)
+	tx.Model(&models.Follow{}).Where("following_id = ?", sourceID).Pluck("follower_id", &sourceFollowers)
+	affected := append([]uint64{targetID, sourceID}, sourceFollowing...)
+	affected = append(affected, sourceFollowers...)
+
+	// 1. 2つのアカウント間のフォローは自分へのフォローになるため削除
+	if err := tx.Where("(follower_id = ? AND following_id = ?) OR (follower_id = ? AND following_id = ?)",
+		sourceID, targetID, targetID, sourceID).Delete(&models.Follow{}).Error; err != nil {
+		return err
+	}
+
+	// 2. 統合先が既に持っている関係は重複になるため削除
+	var targetFollowing, targetFollowers []uint64
+	tx.Model(&models.Follow{}).Where("follower_id = ?", targetID).Pluck("following_id", &targetFollowing)
+	tx.Model(&models.Follow{}).Where("following_id = ?", targetID).Pluck("follower_id", &targetFollowers)
+	if len(targetFollowing) > 0 {
+		if err := tx.Where("follower_id = ? AND following_id IN (?)", sourceID, targetFollowing).Delete(&models.Follow{}).Error; err != nil {
+			return err
+		}
+	}
+	if len(targetFollowers) > 0 {
+		if err := tx.Where("following_id = ? AND follower_id IN (?)", sourceID, targetFollowers).Delete(&models.Follow{}).Error; err != nil {
+			return err
+		}
+	}
+
+	// 3. 残りを付け替え
+	if err := tx.Model(&models.Follow{}).Where("follower_id = ?", sourceID).Update("follower_id", targetID).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.Follow{}).Where("following_id = ?", sourceID).Update("following_id", targetID).Error; err != nil {
+		return err
+	}
+
+	// 4. 関係者のフォロー数を再集計
+	return tx.Exec(`
+		UPDATE users SET
+			follower_count = (SELECT COUNT(*) FROM follows WHERE follows.following_id = users.id),
+			following_count = (SELECT COUNT(*) FROM follows WHERE follows.follower_id = users.id)
+		WHERE id IN (?)`, affected).Error
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -12,22 +13,43 @@ import (
 	"github.com/Kousuke-irie/hackathon-backend/database"
 	"github.com/Kousuke-irie/hackathon-backend/gcs"
 	"github.com/Kousuke-irie/hackathon-backend/gemini"
+	"github.com/Kousuke-irie/hackathon-backend/lifecycle"
+	"github.com/Kousuke-irie/hackathon-backend/middleware"
 	"github.com/Kousuke-irie/hackathon-backend/models"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // ItemDataRequest ★ 新規: フロントエンドの ItemData に合わせた JSON リクエストボディの型を定義
 type ItemDataRequest struct {
-	Title         string `json:"title" binding:"required"`
-	Description   string `json:"description"`
-	Price         string `json:"price" binding:"required"`
-	SellerID      string `json:"seller_id" binding:"required"`
-	ImageURL      string `json:"image_url"` // ★ GCSにアップロード済みのURLを受け取る
-	CategoryID    string `json:"category_id" binding:"required"`
-	Condition     string `json:"condition" binding:"required"`
-	ShippingPayer string `json:"shipping_payer" binding:"required"`
-	ShippingFee   string `json:"shipping_fee" binding:"required"`
-	Status        string `json:"status" binding:"required"`
+	Title         string            `json:"title" binding:"required"`
+	Description   string            `json:"description"`
+	Price         string            `json:"price" binding:"required"`
+	SellerID      string            `json:"seller_id"`  // 省略可。ログインユーザー以外は指定不可
+	ImageURL      string            `json:"image_url"`  // 旧形式: GCSにアップロード済みのURLのJSON配列 (images がない場合のみ使う)
+	Images        []ItemImageInput  `json:"images"`     // GCSにアップロード済みの画像 (表示順、最大10枚)
+	Attributes    map[string]string `json:"attributes"` // カテゴリごとの属性 (例: {"brand": "NIKE", "size": "27"})
+	CategoryID    string            `json:"category_id" binding:"required"`
+	Condition     string            `json:"condition" binding:"required"`
+	ShippingPayer string            `json:"shipping_payer" binding:"required"`
+	ShippingFee   string            `json:"shipping_fee" binding:"required"`
+	Status        string            `json:"status" binding:"required"`
+	Stock         string            `json:"stock"` // 在庫数。省略時は 1
+}
+
+// maxItemStock 1商品に設定できる在庫数の上限
+const maxItemStock = 999
+
+// parseStock 在庫数を読み取る (省略時は 1)
+func parseStock(raw string) (int, error) {
+	if raw == "" {
+		return 1, nil
+	}
+	stock, err := strconv.Atoi(raw)
+	if err != nil || stock < 1 || stock > maxItemStock {
+		return 0, fmt.Errorf("stock must be between 1 and %d", maxItemStock)
+	}
+	return stock, nil
 }
 
 // CreateItemHandler 商品出品API
@@ -39,10 +61,14 @@ func CreateItemHandler(c *gin.Context) {
 	}
 
 	price, err := strconv.Atoi(req.Price)
-	if err != nil {
+	if err != nil || price < 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid price value"})
 		return
 	}
+	if !lifecycle.IsInitial(req.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Status must be DRAFT or ON_SALE"})
+		return
+	}
 
 	categoryID, err := strconv.ParseUint(req.CategoryID, 10, 32) // uint 型に変換
 	if req.Status != "DRAFT" && (err != nil || categoryID == 0) {
@@ -52,33 +78,70 @@ func CreateItemHandler(c *gin.Context) {
 
 	shippingFee, _ := strconv.Atoi(req.ShippingFee)
 
-	sellerID, err := strconv.ParseUint(req.SellerID, 10, 64)
+	stock, err := parseStock(req.Stock)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid seller ID"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 出品者は常にログインユーザー本人
+	if req.SellerID != "" {
+		claimedID, err := strconv.ParseUint(req.SellerID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid seller ID"})
+			return
+		}
+		if rejectForeignActor(c, claimedID) {
+			return
+		}
+	}
+	sellerID := middleware.CurrentUserID(c)
+
+	// 高額商品は本人確認済みの出品者のみ出品できる
+	if !requireVerifiedSellerForPrice(c, price, req.Status) {
 		return
 	}
 
-	// ★ 画像URLが必須のチェック
-	if req.Status != "DRAFT" && (req.ImageURL == "" || req.ImageURL == "[]") {
+	images, err := buildItemImages(req.Images, req.ImageURL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// ★ 画像が必須のチェック
+	if req.Status != "DRAFT" && len(images) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one image is required for ON_SALE items"})
 		return
 	}
 
+	// カテゴリの属性定義に合わない値は受け付けない。出品時は必須の属性も確認する
+	schema, err := loadCategoryAttributes(uint(categoryID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch category attributes"})
+		return
+	}
+	attributes, err := buildItemAttributes(schema, req.Attributes, req.Status == lifecycle.OnSale)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	newItem := models.Item{
 		Title:         req.Title,
 		Description:   req.Description,
 		Price:         price,
 		SellerID:      sellerID,
-		ImageURL:      req.ImageURL,
 		AITags:        "{}",
 		Status:        req.Status,
 		CategoryID:    uint(categoryID),
 		Condition:     req.Condition,
 		ShippingPayer: req.ShippingPayer,
 		ShippingFee:   shippingFee,
+		Stock:         stock,
 	}
 
-	if err := database.DBClient.Create(&newItem).Error; err != nil {
+	if err := database.DBClient.Transaction(func(tx *gorm.DB) error {
+		return saveNewItem(tx, &newItem, images, attributes)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save item"})
 		return
 	}
@@ -86,6 +149,23 @@ func CreateItemHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Item created!", "item": newItem})
 }
 
+// saveNewItem 商品と画像・属性を保存し、最初の版を記録する
+func saveNewItem(tx *gorm.DB, item *models.Item, images []models.ItemImage, attributes []models.ItemAttribute) error {
+	// オークションは出品後に開始する
+	item.ListingType = models.ListingFixed
+	if err := tx.Create(item).Error; err != nil {
+		return err
+	}
+	if err := replaceItemImages(tx, item, images); err != nil {
+		return err
+	}
+	if err := replaceItemAttributes(tx, item, attributes); err != nil {
+		return err
+	}
+	_, err := recordItemRevision(tx, item.ID, item.SellerID)
+	return err
+}
+
 // AnalyzeItemHandler 画像を受け取ってAI解析結果を返す
 func AnalyzeItemHandler(c *gin.Context) {
 	// 1. 画像ファイルを一時保存
@@ -125,8 +205,20 @@ func AnalyzeItemHandler(c *gin.Context) {
 		return
 	}
 
+	// カテゴリごとの属性定義 (親カテゴリの定義は子カテゴリにも適用される)
+	var attributeDefs []models.CategoryAttribute
+	if err := database.DBClient.Find(&attributeDefs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch category attributes for AI"})
+		return
+	}
+	attributesJSON, err := json.Marshal(attributeDefs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to marshal category attributes"})
+		return
+	}
+
 	// 2. Geminiで解析
-	aiResult, err := gemini.AnalyzeImage(c.Request.Context(), savePath, string(categoriesJSONtr))
+	aiResult, err := gemini.AnalyzeImage(c.Request.Context(), savePath, string(categoriesJSONtr), string(attributesJSON))
 	if err != nil {
 		fmt.Printf("AI Error: %v\n", err) // ログに出力
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "AI analysis failed"})
@@ -146,6 +238,13 @@ func AnalyzeItemHandler(c *gin.Context) {
 		aiResult.CategoryID = 0
 	}
 
+	// 属性はカテゴリの定義に合う値だけを下書きとして返す
+	schema, err := loadCategoryAttributes(aiResult.CategoryID)
+	if err != nil {
+		fmt.Printf("Warning: failed to fetch attributes for category %d: %v\n", aiResult.CategoryID, err)
+	}
+	aiResult.Attributes = prefillItemAttributes(schema, aiResult.Attributes)
+
 	// 3. 結果をJSONで返す
 	c.JSON(http.StatusOK, gin.H{
 		"message": "AI analysis successful",
@@ -159,7 +258,7 @@ func GetItemListHandler(c *gin.Context) {
 	conditionName := c.Query("condition")
 	sortBy := c.Query("sort_by")
 	sortOrder := c.Query("sort_order")
-	userID := c.Query("user_id")
+	userID := middleware.CurrentUserID(c) // 未ログインなら 0
 	sellerID := c.Query("seller_id")
 
 	var items []models.Item
@@ -169,14 +268,12 @@ func GetItemListHandler(c *gin.Context) {
 
 	if sellerID != "" {
 		query = query.Where("seller_id = ?", sellerID)
-	} else if userID != "" {
+	} else if userID != 0 {
 		// 通常の一覧では自分以外を出す
 		query = query.Where("seller_id != ?", userID)
 	}
-
-	if userID != "" {
-		query = query.Where("seller_id != ?", userID)
-	}
+	// ブロック・ミュート関係にある出品者の商品は表示しない
+	query = excludeHiddenUsers(query, "seller_id", userID)
 
 	// 💡 カテゴリ絞り込みの強化
 	if categoryIDStr != "" {
@@ -194,6 +291,18 @@ func GetItemListHandler(c *gin.Context) {
 		query = query.Where("condition = ?", conditionName)
 	}
 
+	// 販売形式による絞り込み (listing_type=AUCTION でオークション中の商品のみ)
+	if listingType := c.Query("listing_type"); listingType != "" {
+		query = query.Where("listing_type = ?", listingType)
+	}
+
+	// 💡 属性による絞り込み (例: attr.brand=NIKE, attr_min.size=26&attr_max.size=27.5)
+	query, err := applyAttributeFilters(query, c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	if queryParam != "" {
 		searchQuery := fmt.Sprintf("%%%s%%", queryParam)
 		query = query.Where("title LIKE ? OR description LIKE ?", searchQuery, searchQuery)
@@ -225,7 +334,7 @@ func GetItemDetailHandler(c *gin.Context) {
 	var item models.Item
 
 	// Preload("Seller") で、itemsテーブルのseller_idに紐づくusersテーブルの情報を一緒に取ってくる
-	if err := database.DBClient.Preload("Seller").First(&item, itemID).Error; err != nil {
+	if err := database.DBClient.Preload("Seller").Preload("Images", orderedImages).Preload("Attributes").First(&item, itemID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
 		return
 	}
@@ -235,11 +344,7 @@ func GetItemDetailHandler(c *gin.Context) {
 
 // GetMyItemsHandler ログインユーザーが出品した商品のみを取得
 func GetMyItemsHandler(c *gin.Context) {
-	userID := c.GetHeader("X-User-ID")
-	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
-		return
-	}
+	userID := middleware.CurrentUserID(c)
 
 	// クエリパラメータからステータスを取得 (デフォルトは ON_SALE)
 	statusFilter := c.Query("status")
@@ -278,7 +383,7 @@ type UpdateItemRequest struct {
 // UpdateItemHandler 商品情報を更新 (PUT /items/:id)
 func UpdateItemHandler(c *gin.Context) {
 	itemID := c.Param("id")
-	userID := c.GetHeader("X-User-ID")
+	userID := middleware.CurrentUserID(c)
 
 	var req ItemDataRequest // JSONとして受け取る
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -287,9 +392,17 @@ func UpdateItemHandler(c *gin.Context) {
 	}
 
 	// 2. データ型変換
-	price, _ := strconv.Atoi(req.Price)
+	price, err := strconv.Atoi(req.Price)
+	if err != nil || price < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid price value"})
+		return
+	}
 	shippingFee, _ := strconv.Atoi(req.ShippingFee)
-	categoryID, _ := strconv.ParseUint(req.CategoryID, 10, 32)
+	categoryID, err := strconv.ParseUint(req.CategoryID, 10, 32)
+	if req.Status != lifecycle.Draft && (err != nil || categoryID == 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+		return
+	}
 
 	// 3. 商品の存在確認と権限チェック
 	db := database.DBClient
@@ -301,14 +414,64 @@ func UpdateItemHandler(c *gin.Context) {
 	}
 
 	// 💡 権限チェック: 出品者本人以外は編集不可
-	if strconv.FormatUint(item.SellerID, 10) != userID {
+	if item.SellerID != userID {
 		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have permission to edit this item"})
 		return
 	}
 
-	// 💡 取引中(SOLD)以外は編集可能にする
-	if item.Status == "SOLD" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Sold items cannot be edited"})
+	// 💡 購入手続き中・売却済みの商品は編集不可
+	if !lifecycle.IsEditable(item.Status) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Sold or reserved items cannot be edited"})
+		return
+	}
+	// オークション中の商品は入札者がいるため編集不可 (入札がなければ取り消してから編集する)
+	if isOpenAuctionItem(item) {
+		c.JSON(http.StatusConflict, gin.H{"error": "オークション中の商品は編集できません", "code": "AUCTION_OPEN"})
+		return
+	}
+	// 一時停止・取り下げは専用のAPIで行う (取り下げ時のいいねの整理と通知を漏らさないため)
+	if req.Status != item.Status && (req.Status == lifecycle.Paused || req.Status == lifecycle.Archived) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Use POST /items/:id/pause or POST /items/:id/archive to change the status to " + req.Status})
+		return
+	}
+	// 💡 状態の変更は出品者に許可された遷移のみ (売却済みなどへの変更は不可)
+	if err := lifecycle.Check(item.Status, req.Status, lifecycle.ActorSeller); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Item cannot be changed from %s to %s", item.Status, req.Status)})
+		return
+	}
+
+	// 高額商品は本人確認済みの出品者のみ出品できる
+	if !requireVerifiedSellerForPrice(c, price, req.Status) {
+		return
+	}
+
+	// 画像が指定された場合のみ入れ替える
+	replaceImages := len(req.Images) > 0 || req.ImageURL != ""
+	images, err := buildItemImages(req.Images, req.ImageURL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if replaceImages && req.Status != "DRAFT" && len(images) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one image is required for ON_SALE items"})
+		return
+	}
+
+	// 属性が省略された場合は現在の値を引き継ぐ (カテゴリを変更した場合は新しいカテゴリにない属性を外す)
+	schema, err := loadCategoryAttributes(uint(categoryID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch category attributes"})
+		return
+	}
+	attributeInput := req.Attributes
+	if attributeInput == nil {
+		var current []models.ItemAttribute
+		db.Where("item_id = ?", item.ID).Find(&current)
+		attributeInput = knownAttributeValues(schema, attributeValues(current))
+	}
+	attributes, err := buildItemAttributes(schema, attributeInput, req.Status == lifecycle.OnSale)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -317,31 +480,91 @@ func UpdateItemHandler(c *gin.Context) {
 		"Title":         req.Title,
 		"Description":   req.Description,
 		"Price":         price,
-		"image_url":     req.ImageURL, // ★ JSONから取得したGCS URLを使用
 		"CategoryID":    uint(categoryID),
 		"Condition":     req.Condition,
 		"ShippingPayer": req.ShippingPayer,
 		"ShippingFee":   shippingFee,
-		"Status":        req.Status,
 	}
-
-	if err := db.Model(&item).Updates(updateMap).Error; err != nil {
+	// 在庫数は指定された場合のみ変更する
+	if req.Stock != "" {
+		stock, err := parseStock(req.Stock)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		updateMap["Stock"] = stock
+	}
+
+	oldPrice := item.Price
+	publishing := req.Status == lifecycle.OnSale && item.Status != lifecycle.OnSale
+	var notifications []models.Notification
+	var unpublishable error
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// 確認後に購入手続きが始まっていた場合は更新しない
+		result := tx.Model(&models.Item{}).Where("id = ? AND status = ?", item.ID, item.Status).Updates(updateMap)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return lifecycle.ErrConflict
+		}
+		if replaceImages {
+			if err := replaceItemImages(tx, &item, images); err != nil {
+				return err
+			}
+		}
+		if err := replaceItemAttributes(tx, &item, attributes); err != nil {
+			return err
+		}
+		if req.Status != item.Status {
+			if err := lifecycle.Move(tx, &item, req.Status, lifecycle.ActorSeller); err != nil {
+				return err
+			}
+		}
+		// 💡 下書き・停止中から公開する場合は、予約出品・オークションと同じ条件を更新後の内容で確認する
+		if publishing {
+			var published models.Item
+			if err := tx.Preload("Seller").Preload("Images").Preload("Attributes").First(&published, item.ID).Error; err != nil {
+				return err
+			}
+			if unpublishable = validatePublishable(published); unpublishable != nil {
+				return unpublishable
+			}
+		}
+		// 価格が変わった場合は履歴を残し、値下げならいいねしたユーザーに通知する
+		if price != oldPrice {
+			item.Price = price
+			var err error
+			if notifications, err = recordPriceChange(tx, item, oldPrice, userID); err != nil {
+				return err
+			}
+		}
+		// 変更内容を新しい版として残す
+		_, err := recordItemRevision(tx, item.ID, userID)
+		return err
+	})
+	if errors.Is(err, lifecycle.ErrConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Item status was changed. Please reload and try again"})
+		return
+	}
+	if unpublishable != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": unpublishable.Error()})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update item"})
 		return
 	}
+	broadcastNotifications(notifications)
 
 	// 7. 更新後のデータを返却
-	db.Preload("Seller").First(&item, itemID)
+	db.Preload("Seller").Preload("Images", orderedImages).Preload("Attributes").First(&item, itemID)
 	c.JSON(http.StatusOK, gin.H{"message": "Item updated", "item": item})
 }
 
 // GetMyDraftsHandler 自分の下書き商品一覧を取得
 func GetMyDraftsHandler(c *gin.Context) {
-	userID := c.GetHeader("X-User-ID")
-	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "User ID header is required"})
-		return
-	}
+	userID := middleware.CurrentUserID(c)
 
 	var items []models.Item
 	db := database.DBClient
@@ -381,18 +604,14 @@ func GetItemsByIdsHandler(c *gin.Context) {
 
 // GetMyPurchasesInProgressHandler 自分の取引中の購入商品一覧を取得
 func GetMyPurchasesInProgressHandler(c *gin.Context) {
-	userID := c.GetHeader("X-User-ID")
-	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "User ID header is required"})
-		return
-	}
+	userID := middleware.CurrentUserID(c)
 
 	var transactions []models.Transaction
 	db := database.DBClient
 
-	// buyer_id がログインユーザーIDと一致し、Statusが 'PURCHASED', 'SHIPPED', 'RECEIVED' の取引を取得
+	// buyer_id がログインユーザーIDと一致し、Statusが 'PAYMENT_PENDING' (落札後の支払い待ち), 'PURCHASED', 'SHIPPED', 'RECEIVED' の取引を取得
 	// 'COMPLETED' (取引完了) と 'CANCELED' (キャンセル済) 以外
-	inProgressStatuses := []string{"PURCHASED", "SHIPPED", "RECEIVED"}
+	inProgressStatuses := []string{"PAYMENT_PENDING", "PURCHASED", "SHIPPED", "RECEIVED"}
 
 	if err := db.
 		Preload("Item").        // 関連する商品情報を取得
@@ -419,17 +638,8 @@ func GetGcsUploadUrlHandler(c *gin.Context) {
 		return
 	}
 
-	// 認証済みユーザーIDを取得（フロントからX-User-IDが来ている前提）
-	userIDStr := c.GetHeader("X-User-ID")
-	if userIDStr == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID header is required"})
-		return
-	}
-	userID, err := strconv.ParseUint(userIDStr, 10, 64)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid User ID format"})
-		return
-	}
+	// 認証済みユーザーIDを取得
+	userID := middleware.CurrentUserID(c)
 
 	// GCSの署名付きURLと最終的な画像URLを生成
 	signedURL, imageURL, err := gcs.GenerateSignedUploadURL(c.Request.Context(), req.FileName, userID, req.ContentType)
@@ -447,17 +657,13 @@ func GetGcsUploadUrlHandler(c *gin.Context) {
 
 // GetMySalesInProgressHandler 自分が「販売した」取引中の商品一覧を取得 (出品者用)
 func GetMySalesInProgressHandler(c *gin.Context) {
-	userID := c.GetHeader("X-User-ID")
-	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
-		return
-	}
+	userID := middleware.CurrentUserID(c)
 
 	var transactions []models.Transaction
 	db := database.DBClient
 
 	// 💡 SellerID が自分で、ステータスが完了・キャンセル以外を抽出
-	inProgressStatuses := []string{"PURCHASED", "SHIPPED", "RECEIVED"}
+	inProgressStatuses := []string{"PAYMENT_PENDING", "PURCHASED", "SHIPPED", "RECEIVED"}
 
 	if err := db.
 		Preload("Item").
@@ -474,11 +680,7 @@ func GetMySalesInProgressHandler(c *gin.Context) {
 
 // GetMySalesHistoryHandler 自分が「販売した」完了済みの取引一覧を取得 (出品者用)
 func GetMySalesHistoryHandler(c *gin.Context) {
-	userID := c.GetHeader("X-User-ID")
-	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
-		return
-	}
+	userID := middleware.CurrentUserID(c)
 
 	var transactions []models.Transaction
 	db := database.DBClient
@@ -501,7 +703,7 @@ func GetMySalesHistoryHandler(c *gin.Context) {
 
 // GetFollowingItemsHandler フォロー中ユーザーの出品を取得
 func GetFollowingItemsHandler(c *gin.Context) {
-	userID := c.GetHeader("X-User-ID")
+	userID := middleware.CurrentUserID(c)
 	var items []models.Item
 	// サブクエリでフォロー中のIDを抽出し、それらの最新出品を取得
 	database.DBClient.
@@ -513,11 +715,7 @@ func GetFollowingItemsHandler(c *gin.Context) {
 
 // GetCategoryRecommendationsHandler AIを使用してrecommend
 func GetCategoryRecommendationsHandler(c *gin.Context) {
-	userID := c.GetHeader("X-User-ID")
-	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "User ID header is required"})
-		return
-	}
+	userID := middleware.CurrentUserID(c)
 
 	// 1. 直近5件の閲覧履歴から商品のタイトルを取得
 	var recentItemTitles []string
@@ -558,18 +756,18 @@ func GetCategoryRecommendationsHandler(c *gin.Context) {
 
 // GetRecommendedUsersHandler おすすめのアカウント（共通のカテゴリを出品している人など）
 func GetRecommendedUsersHandler(c *gin.Context) {
-	userID := c.GetHeader("X-User-ID")
+	userID := middleware.CurrentUserID(c)
 	var users []models.User
 	// 実装例: まだフォローしていない、かつ出品数が多いユーザーを推奨
-	database.DBClient.Where("id != ? AND id NOT IN (SELECT following_id FROM follows WHERE follower_id = ?)", userID, userID).
+	query := database.DBClient.Where("id != ? AND id NOT IN (SELECT following_id FROM follows WHERE follower_id = ?)", userID, userID)
+	excludeHiddenUsers(query, "id", userID).
 		Order("follower_count DESC").Limit(8).Find(&users)
 	c.JSON(http.StatusOK, gin.H{"users": users})
 }
 
 // RecordViewHandler 商品の閲覧を記録
 func RecordViewHandler(c *gin.Context) {
-	userIDStr := c.GetHeader("X-User-ID")
-	userID, _ := strconv.ParseUint(userIDStr, 10, 64)
+	userID := middleware.CurrentUserID(c) // 未ログインなら 0
 
 	itemIDStr := c.Param("id")
 	itemID, _ := strconv.ParseUint(itemIDStr, 10, 64)
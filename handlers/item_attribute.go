@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Kousuke-irie/hackathon-backend/database"
+	"github.com/Kousuke-irie/hackathon-backend/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxTextAttributeLength TEXT 型の属性値の最大文字数
+const maxTextAttributeLength = 100
+
+// loadCategoryAttributes カテゴリとその親カテゴリに定義された属性を表示順で返す
+// 同じ Name の定義は、より下位のカテゴリのものを使う
+func loadCategoryAttributes(categoryID uint) ([]models.CategoryAttribute, error) {
+	// 下位から順にカテゴリをたどる (depth 0 が指定されたカテゴリ)
+	depth := map[uint]int{}
+	for id := categoryID; id != 0; {
+		if _, seen := depth[id]; seen {
+			break
+		}
+		var category models.Category
+		if err := database.DBClient.First(&category, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				break
+			}
+			return nil, err
+		}
+		depth[id] = len(depth)
+		if category.ParentID == nil {
+			break
+		}
+		id = *category.ParentID
+	}
+	if len(depth) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uint, 0, len(depth))
+	for id := range depth {
+		ids = append(ids, id)
+	}
+	var definitions []models.CategoryAttribute
+	if err := database.DBClient.Where("category_id IN ?", ids).Find(&definitions).Error; err != nil {
+		return nil, err
+	}
+
+	byName := map[string]models.CategoryAttribute{}
+	for _, def := range definitions {
+		if cur, ok := byName[def.Name]; !ok || depth[def.CategoryID] < depth[cur.CategoryID] {
+			byName[def.Name] = def
+		}
+	}
+	schema := make([]models.CategoryAttribute, 0, len(byName))
+	for _, def := range byName {
+		schema = append(schema, def)
+	}
+	sort.Slice(schema, func(i, j int) bool {
+		if schema[i].Position != schema[j].Position {
+			return schema[i].Position < schema[j].Position
+		}
+		return schema[i].Name < schema[j].Name
+	})
+	return schema, nil
+}
+
+// buildItemAttributes 属性値をカテゴリの定義で検証し、保存する形に変換する
+// requireAll が true の場合 (出品時) は必須の属性がすべて入力されていることも確認する
+func buildItemAttributes(schema []models.CategoryAttribute, values map[string]string, requireAll bool) ([]models.ItemAttribute, error) {
+	defs := make(map[string]models.CategoryAttribute, len(schema))
+	for _, def := range schema {
+		defs[def.Name] = def
+	}
+
+	attributes := make([]models.ItemAttribute, 0, len(values))
+	for name, raw := range values {
+		def, ok := defs[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown attribute for this category: %s", name)
+		}
+		value := strings.TrimSpace(raw)
+		if value == "" {
+			continue
+		}
+
+		attr := models.ItemAttribute{Name: name, Value: value}
+		switch def.Type {
+		case models.AttributeTypeNumber:
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("attribute %s must be a number", name)
+			}
+			attr.Value = strconv.FormatFloat(n, 'f', -1, 64)
+			attr.NumberValue = &n
+		case models.AttributeTypeEnum:
+			if !containsString(def.AllowedValues, value) {
+				return nil, fmt.Errorf("attribute %s must be one of: %s", name, strings.Join(def.AllowedValues, ", "))
+			}
+		default:
+			if utf8.RuneCountInString(value) > maxTextAttributeLength {
+				return nil, fmt.Errorf("attribute %s must be at most %d characters", name, maxTextAttributeLength)
+			}
+		}
+		attributes = append(attributes, attr)
+	}
+
+	if requireAll {
+		for _, def := range schema {
+			if def.Required && strings.TrimSpace(values[def.Name]) == "" {
+				return nil, fmt.Errorf("attribute %s is required", def.Name)
+			}
+		}
+	}
+	sort.Slice(attributes, func(i, j int) bool { return attributes[i].Name < attributes[j].Name })
+	return attributes, nil
+}
+
+// knownAttributeValues カテゴリに定義されていない属性を取り除く (カテゴリを変更した場合など)
+func knownAttributeValues(schema []models.CategoryAttribute, values map[string]string) map[string]string {
+	result := make(map[string]string, len(values))
+	for _, def := range schema {
+		if v, ok := values[def.Name]; ok {
+			result[def.Name] = v
+		}
+	}
+	return result
+}
+
+// attributeValues 保存済みの属性を名前から値への対応に変換する
+func attributeValues(attributes []models.ItemAttribute) map[string]string {
+	values := make(map[string]string, len(attributes))
+	for _, attr := range attributes {
+		values[attr.Name] = attr.Value
+	}
+	return values
+}
+
+// replaceItemAttributes 商品の属性を入れ替える
+func replaceItemAttributes(tx *gorm.DB, item *models.Item, attributes []models.ItemAttribute) error {
+	if err := tx.Where("item_id = ?", item.ID).Delete(&models.ItemAttribute{}).Error; err != nil {
+		return err
+	}
+	for i := range attributes {
+		attributes[i].ItemID = item.ID
+	}
+	if len(attributes) > 0 {
+		if err := tx.Create(&attributes).Error; err != nil {
+			return err
+		}
+	}
+	item.Attributes = attributes
+	return nil
+}
+
+// applyAttributeFilters 商品一覧の属性による絞り込みをクエリに追加する
+// attr.<name>=a,b は値のいずれかに一致、attr_min.<name> / attr_max.<name> は NUMBER 型の範囲で絞り込む
+func applyAttributeFilters(query *gorm.DB, params url.Values) (*gorm.DB, error) {
+	const exists = "EXISTS (SELECT 1 FROM item_attributes WHERE item_attributes.item_id = items.id AND item_attributes.name = ? AND "
+	for key, values := range params {
+		if len(values) == 0 || values[0] == "" {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(key, "attr."):
+			query = query.Where(exists+"item_attributes.value IN ?)", strings.TrimPrefix(key, "attr."), strings.Split(values[0], ","))
+		case strings.HasPrefix(key, "attr_min."), strings.HasPrefix(key, "attr_max."):
+			n, err := strconv.ParseFloat(values[0], 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be a number", key)
+			}
+			if name, ok := strings.CutPrefix(key, "attr_min."); ok {
+				query = query.Where(exists+"item_attributes.number_value >= ?)", name, n)
+			} else {
+				query = query.Where(exists+"item_attributes.number_value <= ?)", strings.TrimPrefix(key, "attr_max."), n)
+			}
+		}
+	}
+	return query, nil
+}
+
+// prefillItemAttributes AIが推測した属性値のうち、カテゴリの定義に合うものだけを返す
+func prefillItemAttributes(schema []models.CategoryAttribute, guessed map[string]interface{}) map[string]interface{} {
+	result := map[string]interface{}{}
+	for name, v := range guessed {
+		if v == nil {
+			continue
+		}
+		attrs, err := buildItemAttributes(schema, map[string]string{name: fmt.Sprint(v)}, false)
+		if err != nil || len(attrs) == 0 {
+			continue
+		}
+		result[name] = attrs[0].Value
+	}
+	return result
+}
+
+// containsString values に s が含まれるかを返す
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// GetCategoryAttributesHandler カテゴリの属性定義を取得 (GET /meta/categories/:id/attributes)
+// 親カテゴリから引き継いだ属性も含む
+func GetCategoryAttributesHandler(c *gin.Context) {
+	categoryID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+		return
+	}
+
+	schema, err := loadCategoryAttributes(uint(categoryID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch category attributes"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"attributes": schema})
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/Kousuke-irie/hackathon-backend/models"
+	"gorm.io/gorm"
+)
+
+// ItemImageInput 出品・編集時に受け取る画像 (配列の順番が表示順になる)
+type ItemImageInput struct {
+	URL     string `json:"url"`
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+	IsCover bool   `json:"is_cover"`
+}
+
+var errTooManyImages = fmt.Errorf("up to %d images are allowed", models.MaxItemImages)
+
+// buildItemImages リクエストから並び順付きの画像一覧を作る
+// images が空の場合は旧形式の image_url (JSON配列) を読み取る。カバー未指定なら先頭をカバーにする
+func buildItemImages(images []ItemImageInput, legacyImageURL string) ([]models.ItemImage, error) {
+	if len(images) == 0 {
+		for _, url := range models.SplitImageURLs(legacyImageURL) {
+			images = append(images, ItemImageInput{URL: url})
+		}
+	}
+	if len(images) > models.MaxItemImages {
+		return nil, errTooManyImages
+	}
+
+	result := make([]models.ItemImage, 0, len(images))
+	coverIndex := -1
+	for _, img := range images {
+		if img.URL == "" {
+			return nil, errors.New("image url is required")
+		}
+		if img.IsCover && coverIndex == -1 {
+			coverIndex = len(result)
+		}
+		result = append(result, models.ItemImage{
+			URL:      img.URL,
+			Position: len(result),
+			Width:    img.Width,
+			Height:   img.Height,
+		})
+	}
+	if len(result) > 0 {
+		if coverIndex == -1 {
+			coverIndex = 0
+		}
+		result[coverIndex].IsCover = true
+	}
+	return result, nil
+}
+
+// replaceItemImages 商品の画像を入れ替え、一覧用のカバー画像と旧形式の image_url を更新する
+func replaceItemImages(tx *gorm.DB, item *models.Item, images []models.ItemImage) error {
+	if err := tx.Where("item_id = ?", item.ID).Delete(&models.ItemImage{}).Error; err != nil {
+		return err
+	}
+
+	urls := make([]string, len(images))
+	cover := ""
+	for i := range images {
+		images[i].ItemID = item.ID
+		urls[i] = images[i].URL
+		if images[i].IsCover {
+			cover = images[i].URL
+		}
+	}
+	if len(images) > 0 {
+		if err := tx.Create(&images).Error; err != nil {
+			return err
+		}
+	}
+
+	legacy, err := json.Marshal(urls)
+	if err != nil {
+		return err
+	}
+	item.ImageURL = string(legacy)
+	item.CoverImageURL = cover
+	item.Images = images
+	return tx.Model(&models.Item{}).Where("id = ?", item.ID).Updates(map[string]interface{}{
+		"image_url":       item.ImageURL,
+		"cover_image_url": item.CoverImageURL,
+	}).Error
+}
+
+// orderedImages 画像を表示順で Preload する
+func orderedImages(db *gorm.DB) *gorm.DB {
+	return db.Order("position ASC")
+}
@@ -0,0 +1,395 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Kousuke-irie/hackathon-backend/database"
+	"github.com/Kousuke-irie/hackathon-backend/lifecycle"
+	"github.com/Kousuke-irie/hackathon-backend/middleware"
+	"github.com/Kousuke-irie/hackathon-backend/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxImportRows 一括出品で1回に登録できる行数
+	maxImportRows = 200
+	// maxImportFileSize 一括出品のファイルの最大サイズ
+	maxImportFileSize = 5 << 20
+)
+
+// ItemImportRow 一括出品の1行 (ItemDataRequest と同じ項目に画像URLの一覧を加えたもの)
+// status は使わず、常に下書き (DRAFT) として登録する
+type ItemImportRow struct {
+	ItemDataRequest
+	ImageURLs []string `json:"image_urls"`
+}
+
+// ItemImportResult 一括出品の行ごとの結果 (Row は 1 始まり。CSV はヘッダー行を数えない)
+type ItemImportResult struct {
+	Row    int      `json:"row"`
+	ItemID uint64   `json:"item_id,omitempty"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+// importLine 読み込んだ1行。形式の誤りで読み込めなかった場合は Err に入る
+type importLine struct {
+	Row ItemImportRow
+	Err error
+}
+
+// parseImportCSV ヘッダー付きの CSV を読み込む
+// 列名は ItemDataRequest の JSON のキーと同じ。image_urls は "|" 区切り、attr.<name> は属性
+func parseImportCSV(r io.Reader) ([]importLine, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.New("CSV header is required")
+	}
+	for i, col := range header {
+		if i == 0 {
+			col = strings.TrimPrefix(col, "\ufeff") // Excel が付ける BOM
+		}
+		header[i] = strings.ToLower(strings.TrimSpace(col))
+	}
+
+	var lines []importLine
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if len(lines) >= maxImportRows {
+			return nil, fmt.Errorf("up to %d rows can be imported at once", maxImportRows)
+		}
+		if err != nil {
+			if errors.Is(err, csv.ErrFieldCount) {
+				lines = append(lines, importLine{Err: errors.New("column count does not match the header")})
+				continue
+			}
+			return nil, fmt.Errorf("invalid CSV: %v", err)
+		}
+
+		var row ItemImportRow
+		for i, value := range record {
+			setImportColumn(&row, header[i], strings.TrimSpace(value))
+		}
+		lines = append(lines, importLine{Row: row})
+	}
+	return lines, nil
+}
+
+// setImportColumn CSV の1列の値を行に設定する。未知の列は無視する
+func setImportColumn(row *ItemImportRow, column, value string) {
+	switch column {
+	case "title":
+		row.Title = value
+	case "description":
+		row.Description = value
+	case "price":
+		row.Price = value
+	case "category_id":
+		row.CategoryID = value
+	case "condition":
+		row.Condition = value
+	case "shipping_payer":
+		row.ShippingPayer = value
+	case "shipping_fee":
+		row.ShippingFee = value
+	case "stock":
+		row.Stock = value
+	case "image_url":
+		row.ImageURL = value
+	case "image_urls":
+		for _, url := range strings.Split(value, "|") {
+			if url = strings.TrimSpace(url); url != "" {
+				row.ImageURLs = append(row.ImageURLs, url)
+			}
+		}
+	default:
+		if name, ok := strings.CutPrefix(column, "attr."); ok && value != "" {
+			if row.Attributes == nil {
+				row.Attributes = map[string]string{}
+			}
+			row.Attributes[name] = value
+		}
+	}
+}
+
+// parseImportJSONLines 1行に1つの JSON オブジェクト (ItemImportRow) を読み込む。空行は無視する
+func parseImportJSONLines(r io.Reader) ([]importLine, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxImportFileSize)
+
+	var lines []importLine
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		if len(lines) >= maxImportRows {
+			return nil, fmt.Errorf("up to %d rows can be imported at once", maxImportRows)
+		}
+		var row ItemImportRow
+		if err := json.Unmarshal([]byte(text), &row); err != nil {
+			lines = append(lines, importLine{Err: errors.New("invalid JSON")})
+			continue
+		}
+		lines = append(lines, importLine{Row: row})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read file: %v", err)
+	}
+	return lines, nil
+}
+
+// itemImportValidator 一括出品の行を検証する (カテゴリ・商品状態・属性定義は1回だけ読み込む)
+type itemImportValidator struct {
+	sellerID   uint64
+	categories map[uint]bool
+	conditions map[string]bool
+	schemas    map[uint][]models.CategoryAttribute
+}
+
+func newItemImportValidator(sellerID uint64) (*itemImportValidator, error) {
+	v := &itemImportValidator{
+		sellerID:   sellerID,
+		categories: map[uint]bool{},
+		conditions: map[string]bool{},
+		schemas:    map[uint][]models.CategoryAttribute{},
+	}
+
+	var categoryIDs []uint
+	if err := database.DBClient.Model(&models.Category{}).Pluck("id", &categoryIDs).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range categoryIDs {
+		v.categories[id] = true
+	}
+
+	var conditionNames []string
+	if err := database.DBClient.Model(&models.ProductCondition{}).Pluck("name", &conditionNames).Error; err != nil {
+		return nil, err
+	}
+	for _, name := range conditionNames {
+		v.conditions[name] = true
+	}
+	return v, nil
+}
+
+// validate 行を検証し、登録する商品・画像・属性を返す。誤りがあればすべての内容を errs に入れる
+func (v *itemImportValidator) validate(row ItemImportRow) (item models.Item, images []models.ItemImage, attributes []models.ItemAttribute, errs []string) {
+	if strings.TrimSpace(row.Title) == "" {
+		errs = append(errs, "title is required")
+	}
+
+	price, err := strconv.Atoi(row.Price)
+	if err != nil || price < 0 {
+		errs = append(errs, "price must be a non-negative integer")
+	}
+
+	shippingFee := 0
+	if row.ShippingFee != "" {
+		if shippingFee, err = strconv.Atoi(row.ShippingFee); err != nil || shippingFee < 0 {
+			errs = append(errs, "shipping_fee must be a non-negative integer")
+		}
+	}
+
+	stock, err := parseStock(row.Stock)
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	categoryID, err := strconv.ParseUint(row.CategoryID, 10, 32)
+	if err != nil || !v.categories[uint(categoryID)] {
+		errs = append(errs, "category_id does not exist")
+	} else {
+		schema, err := v.schema(uint(categoryID))
+		if err != nil {
+			return item, nil, nil, append(errs, "failed to fetch category attributes")
+		}
+		if attributes, err = buildItemAttributes(schema, row.Attributes, false); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if !v.conditions[row.Condition] {
+		errs = append(errs, "condition does not exist")
+	}
+
+	inputs := row.Images
+	if len(inputs) == 0 {
+		for _, url := range row.ImageURLs {
+			inputs = append(inputs, ItemImageInput{URL: url})
+		}
+	}
+	if images, err = buildItemImages(inputs, row.ImageURL); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	item = models.Item{
+		Title:         row.Title,
+		Description:   row.Description,
+		Price:         price,
+		SellerID:      v.sellerID,
+		AITags:        "{}",
+		Status:        lifecycle.Draft,
+		CategoryID:    uint(categoryID),
+		Condition:     row.Condition,
+		ShippingPayer: row.ShippingPayer,
+		ShippingFee:   shippingFee,
+		Stock:         stock,
+	}
+	return item, images, attributes, errs
+}
+
+// schema カテゴリの属性定義を返す (同じカテゴリは2回目から読み込まない)
+func (v *itemImportValidator) schema(categoryID uint) ([]models.CategoryAttribute, error) {
+	if schema, ok := v.schemas[categoryID]; ok {
+		return schema, nil
+	}
+	schema, err := loadCategoryAttributes(categoryID)
+	if err != nil {
+		return nil, err
+	}
+	v.schemas[categoryID] = schema
+	return schema, nil
+}
+
+// ImportItemsHandler CSV または JSON Lines の商品を一括で下書き登録する (POST /items/import)
+// multipart の file で受け取り、形式は format (csv / jsonl) か拡張子で判定する
+// mode=atomic の場合は1行でも誤りがあれば何も登録しない。既定 (per_row) は誤りのない行だけ登録する
+func ImportItemsHandler(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportFileSize+1<<20)
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required (up to 5MB)"})
+		return
+	}
+	if fileHeader.Size > maxImportFileSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file must be up to 5MB"})
+		return
+	}
+
+	mode := c.DefaultPostForm("mode", "per_row")
+	if mode != "per_row" && mode != "atomic" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be per_row or atomic"})
+		return
+	}
+	format := strings.ToLower(c.PostForm("format"))
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(fileHeader.Filename)) {
+		case ".csv":
+			format = "csv"
+		case ".jsonl", ".ndjson", ".json":
+			format = "jsonl"
+		}
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer file.Close()
+
+	var lines []importLine
+	switch format {
+	case "csv":
+		lines, err = parseImportCSV(file)
+	case "jsonl":
+		lines, err = parseImportJSONLines(file)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or jsonl"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(lines) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No rows to import"})
+		return
+	}
+
+	validator, err := newItemImportValidator(middleware.CurrentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load categories and conditions"})
+		return
+	}
+
+	// 1. すべての行を検証する
+	type pendingItem struct {
+		result     *ItemImportResult
+		item       models.Item
+		images     []models.ItemImage
+		attributes []models.ItemAttribute
+	}
+	results := make([]ItemImportResult, len(lines))
+	var pending []pendingItem
+	for i, line := range lines {
+		results[i].Row = i + 1
+		if line.Err != nil {
+			results[i].Errors = []string{line.Err.Error()}
+			continue
+		}
+		item, images, attributes, errs := validator.validate(line.Row)
+		if len(errs) > 0 {
+			results[i].Errors = errs
+			continue
+		}
+		pending = append(pending, pendingItem{&results[i], item, images, attributes})
+	}
+	failed := len(lines) - len(pending)
+
+	// 2. 登録する
+	if mode == "atomic" {
+		if failed > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Some rows are invalid. Nothing was imported", "mode": mode, "created": 0, "failed": failed, "results": results})
+			return
+		}
+		err := database.DBClient.Transaction(func(tx *gorm.DB) error {
+			for _, p := range pending {
+				if err := saveNewItem(tx, &p.item, p.images, p.attributes); err != nil {
+					return err
+				}
+				p.result.ItemID = p.item.ID
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Printf("Import Items Error: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import items"})
+			return
+		}
+	} else {
+		for _, p := range pending {
+			err := database.DBClient.Transaction(func(tx *gorm.DB) error {
+				return saveNewItem(tx, &p.item, p.images, p.attributes)
+			})
+			if err != nil {
+				fmt.Printf("Import Items Error (row %d): %v\n", p.result.Row, err)
+				p.result.Errors = []string{"failed to save item"}
+				failed++
+				continue
+			}
+			p.result.ItemID = p.item.ID
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"mode":    mode,
+		"created": len(lines) - failed,
+		"failed":  failed,
+		"results": results,
+	})
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseImportCSV(t *testing.T) {
+	t.Run("strips BOM and normalizes header", func(t *testing.T) {
+		input := "\ufeffTitle , Price,image_urls,attr.brand\nシャツ,1200, https://a/1.jpg | https://a/2.jpg ,UNIQLO\n"
+		lines, err := parseImportCSV(strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("parseImportCSV() error = %v", err)
+		}
+		if len(lines) != 1 || lines[0].Err != nil {
+			t.Fatalf("parseImportCSV() = %+v, want 1 valid line", lines)
+		}
+		row := lines[0].Row
+		if row.Title != "シャツ" || row.Price != "1200" {
+			t.Errorf("row = %+v, want title シャツ and price 1200", row)
+		}
+		if want := []string{"https://a/1.jpg", "https://a/2.jpg"}; !reflect.DeepEqual(row.ImageURLs, want) {
+			t.Errorf("ImageURLs = %v, want %v", row.ImageURLs, want)
+		}
+		if row.Attributes["brand"] != "UNIQLO" {
+			t.Errorf("Attributes = %v, want brand UNIQLO", row.Attributes)
+		}
+	})
+
+	t.Run("field count mismatch is reported per row", func(t *testing.T) {
+		input := "title,price\nA,100\nB\nC,300\n"
+		lines, err := parseImportCSV(strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("parseImportCSV() error = %v", err)
+		}
+		if len(lines) != 3 {
+			t.Fatalf("len(lines) = %d, want 3", len(lines))
+		}
+		if lines[0].Err != nil || lines[2].Err != nil {
+			t.Errorf("valid rows have errors: %v, %v", lines[0].Err, lines[2].Err)
+		}
+		if lines[1].Err == nil {
+			t.Error("short row has no error")
+		}
+	})
+
+	t.Run("missing header", func(t *testing.T) {
+		if _, err := parseImportCSV(strings.NewReader("")); err == nil {
+			t.Error("parseImportCSV() error = nil, want header error")
+		}
+	})
+
+	t.Run("row limit", func(t *testing.T) {
+		within := "title\n" + strings.Repeat("A\n", maxImportRows)
+		if lines, err := parseImportCSV(strings.NewReader(within)); err != nil || len(lines) != maxImportRows {
+			t.Errorf("parseImportCSV(%d rows) = %d lines, %v", maxImportRows, len(lines), err)
+		}
+		over := within + "A\n"
+		if _, err := parseImportCSV(strings.NewReader(over)); err == nil {
+			t.Errorf("parseImportCSV(%d rows) error = nil, want limit error", maxImportRows+1)
+		}
+	})
+}
+
+func TestParseImportJSONLines(t *testing.T) {
+	t.Run("skips blank lines and reports invalid JSON", func(t *testing.T) {
+		input := `{"title":"A","price":"100","image_urls":["https://a/1.jpg"]}
+
+not json
+{"title":"B","attributes":{"size":"M"}}
+`
+		lines, err := parseImportJSONLines(strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("parseImportJSONLines() error = %v", err)
+		}
+		if len(lines) != 3 {
+			t.Fatalf("len(lines) = %d, want 3", len(lines))
+		}
+		if lines[0].Err != nil || lines[0].Row.Title != "A" || len(lines[0].Row.ImageURLs) != 1 {
+			t.Errorf("lines[0] = %+v", lines[0])
+		}
+		if lines[1].Err == nil {
+			t.Error("invalid JSON line has no error")
+		}
+		if lines[2].Err != nil || lines[2].Row.Attributes["size"] != "M" {
+			t.Errorf("lines[2] = %+v", lines[2])
+		}
+	})
+
+	t.Run("row limit", func(t *testing.T) {
+		within := strings.Repeat(`{"title":"A"}`+"\n", maxImportRows)
+		if lines, err := parseImportJSONLines(strings.NewReader(within)); err != nil || len(lines) != maxImportRows {
+			t.Errorf("parseImportJSONLines(%d rows) = %d lines, %v", maxImportRows, len(lines), err)
+		}
+		over := within + `{"title":"A"}` + "\n"
+		if _, err := parseImportJSONLines(strings.NewReader(over)); err == nil {
+			t.Errorf("parseImportJSONLines(%d rows) error = nil, want limit error", maxImportRows+1)
+		}
+	})
+}
+
+func TestSetImportColumn(t *testing.T) {
+	tests := []struct {
+		name   string
+		column string
+		value  string
+		want   ItemImportRow
+	}{
+		{"title", "title", "シャツ", ItemImportRow{ItemDataRequest: ItemDataRequest{Title: "シャツ"}}},
+		{"stock", "stock", "3", ItemImportRow{ItemDataRequest: ItemDataRequest{Stock: "3"}}},
+		{"image urls drop blanks", "image_urls", "https://a/1.jpg||  |https://a/2.jpg", ItemImportRow{ImageURLs: []string{"https://a/1.jpg", "https://a/2.jpg"}}},
+		{"attribute", "attr.color", "red", ItemImportRow{ItemDataRequest: ItemDataRequest{Attributes: map[string]string{"color": "red"}}}},
+		{"empty attribute is ignored", "attr.color", "", ItemImportRow{}},
+		{"unknown column is ignored", "status", "ON_SALE", ItemImportRow{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var row ItemImportRow
+			setImportColumn(&row, tt.column, tt.value)
+			if !reflect.DeepEqual(row, tt.want) {
+				t.Errorf("setImportColumn(%q, %q) = %+v, want %+v", tt.column, tt.value, row, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+
+	"github.com/Kousuke-irie/hackathon-backend/database"
+	"github.com/Kousuke-irie/hackathon-backend/middleware"
+	"github.com/Kousuke-irie/hackathon-backend/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// itemSnapshotFields 版の比較に使う項目 (名前は ItemSnapshot の JSON のキー)
+var itemSnapshotFields = []struct {
+	Name  string
+	Value func(models.ItemSnapshot) interface{}
+}{
+	{"title", func(s models.ItemSnapshot) interface{} { return s.Title }},
+	{"description", func(s models.ItemSnapshot) interface{} { return s.Description }},
+	{"price", func(s models.ItemSnapshot) interface{} { return s.Price }},
+	{"category_id", func(s models.ItemSnapshot) interface{} { return s.CategoryID }},
+	{"condition", func(s models.ItemSnapshot) interface{} { return s.Condition }},
+	{"shipping_payer", func(s models.ItemSnapshot) interface{} { return s.ShippingPayer }},
+	{"shipping_fee", func(s models.ItemSnapshot) interface{} { return s.ShippingFee }},
+	{"attributes", func(s models.ItemSnapshot) interface{} { return s.Attributes }},
+	{"image_urls", func(s models.ItemSnapshot) interface{} { return s.ImageURLs }},
+	{"cover_image_url", func(s models.ItemSnapshot) interface{} { return s.CoverImageURL }},
+}
+
+// ItemFieldChange 2つの版の間で変わった項目
+type ItemFieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// snapshotItem 商品の内容を版として保存する形に変換する (item.Images は表示順に、item.Attributes も読み込んでおく)
+func snapshotItem(item models.Item) models.ItemSnapshot {
+	urls := make([]string, len(item.Images))
+	for i, img := range item.Images {
+		urls[i] = img.URL
+	}
+	var attributes map[string]string
+	if len(item.Attributes) > 0 {
+		attributes = attributeValues(item.Attributes)
+	}
+	return models.ItemSnapshot{
+		Title:         item.Title,
+		Description:   item.Description,
+		Price:         item.Price,
+		CategoryID:    item.CategoryID,
+		Condition:     item.Condition,
+		ShippingPayer: item.ShippingPayer,
+		ShippingFee:   item.ShippingFee,
+		Attributes:    attributes,
+		ImageURLs:     urls,
+		CoverImageURL: item.CoverImageURL,
+	}
+}
+
+// diffItemSnapshots from から to で変わった項目を返す
+func diffItemSnapshots(from, to models.ItemSnapshot) []ItemFieldChange {
+	changes := []ItemFieldChange{}
+	for _, f := range itemSnapshotFields {
+		a, b := f.Value(from), f.Value(to)
+		if !reflect.DeepEqual(a, b) {
+			changes = append(changes, ItemFieldChange{Field: f.Name, From: a, To: b})
+		}
+	}
+	return changes
+}
+
+// recordItemRevision 商品の現在の内容を新しい版として保存する
+// 直前の版から内容が変わっていない場合は保存せず、直前の版を返す
+// 商品の行を更新したのと同じトランザクション内で呼び出す
+func recordItemRevision(tx *gorm.DB, itemID, editorID uint64) (models.ItemRevision, error) {
+	// 同時に編集されても版番号が重複しないよう、商品の行をロックしてから採番する
+	var item models.Item
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Preload("Images", orderedImages).
+		Preload("Attributes").
+		First(&item, itemID).Error; err != nil {
+		return models.ItemRevision{}, err
+	}
+
+	var latest models.ItemRevision
+	if err := tx.Where("item_id = ?", itemID).Order("version DESC").Limit(1).Find(&latest).Error; err != nil {
+		return models.ItemRevision{}, err
+	}
+
+	revision := models.ItemRevision{
+		ItemID:   itemID,
+		Version:  1,
+		EditorID: editorID,
+		Snapshot: snapshotItem(item),
+	}
+	if latest.ID == 0 {
+		for _, f := range itemSnapshotFields {
+			revision.ChangedFields = append(revision.ChangedFields, f.Name)
+		}
+	} else {
+		changes := diffItemSnapshots(latest.Snapshot, revision.Snapshot)
+		if len(changes) == 0 {
+			return latest, nil
+		}
+		revision.Version = latest.Version + 1
+		for _, ch := range changes {
+			revision.ChangedFields = append(revision.ChangedFields, ch.Field)
+		}
+	}
+
+	if err := tx.Create(&revision).Error; err != nil {
+		return models.ItemRevision{}, err
+	}
+	return revision, nil
+}
+
+// loadRevisionViewableItem 商品を取得し、ログインユーザーが版の履歴を閲覧できることを確認する
+// 閲覧できるのは出品者、その商品の取引の購入者、モデレーターのみ。削除済みの商品も対象にする
+// 失敗時はレスポンスを書き込んで false を返す
+func loadRevisionViewableItem(c *gin.Context) (models.Item, bool) {
+	var item models.Item
+	if err := database.DBClient.Unscoped().First(&item, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return item, false
+	}
+
+	userID := middleware.CurrentUserID(c)
+	if item.SellerID == userID || middleware.HasPermission(c, middleware.PermModerateContent) {
+		return item, true
+	}
+	var count int64
+	database.DBClient.Model(&models.Transaction{}).Where("item_id = ? AND buyer_id = ?", item.ID, userID).Count(&count)
+	if count == 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have permission to view revisions of this item"})
+		return item, false
+	}
+	return item, true
+}
+
+// GetItemRevisionsHandler 商品の版の一覧を新しい順に取得 (GET /items/:id/revisions)
+func GetItemRevisionsHandler(c *gin.Context) {
+	item, ok := loadRevisionViewableItem(c)
+	if !ok {
+		return
+	}
+
+	var revisions []models.ItemRevision
+	if err := database.DBClient.Where("item_id = ?", item.ID).
+		Order("version DESC").
+		Find(&revisions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch revisions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"revisions": revisions})
+}
+
+// GetItemRevisionDiffHandler 2つの版の差分を取得 (GET /items/:id/revisions/diff?from=1&to=3)
+// to を省略すると最新の版、from を省略すると to の1つ前の版と比較する
+func GetItemRevisionDiffHandler(c *gin.Context) {
+	item, ok := loadRevisionViewableItem(c)
+	if !ok {
+		return
+	}
+
+	var to models.ItemRevision
+	query := database.DBClient.Where("item_id = ?", item.ID)
+	if v := c.Query("to"); v != "" {
+		version, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to version"})
+			return
+		}
+		query = query.Where("version = ?", version)
+	}
+	if err := query.Order("version DESC").First(&to).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+		return
+	}
+
+	fromVersion := to.Version - 1
+	if v := c.Query("from"); v != "" {
+		version, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from version"})
+			return
+		}
+		fromVersion = version
+	}
+
+	// 最初の版は空の内容と比較する
+	var from models.ItemRevision
+	if fromVersion > 0 {
+		if err := database.DBClient.Where("item_id = ? AND version = ?", item.ID, fromVersion).First(&from).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from_version": fromVersion,
+		"to_version":   to.Version,
+		"changes":      diffItemSnapshots(from.Snapshot, to.Snapshot),
+	})
+}
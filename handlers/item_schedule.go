@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Kousuke-irie/hackathon-backend/database"
+	"github.com/Kousuke-irie/hackathon-backend/lifecycle"
+	"github.com/Kousuke-irie/hackathon-backend/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxPublishSchedule 予約出品で指定できる最も先の日時 (現在から)
+const maxPublishSchedule = 90 * 24 * time.Hour
+
+// validatePublishable 商品を ON_SALE にできるかを CreateItemHandler と同じ規則で確認する
+// item には Seller・Images・Attributes を読み込んでおく
+func validatePublishable(item models.Item) error {
+	if item.Price < 0 {
+		return errors.New("価格が正しくありません")
+	}
+	if item.CategoryID == 0 {
+		return errors.New("カテゴリが設定されていません")
+	}
+	if len(item.Images) == 0 {
+		return errors.New("画像が1枚以上必要です")
+	}
+	schema, err := loadCategoryAttributes(item.CategoryID)
+	if err != nil {
+		return err
+	}
+	if _, err := buildItemAttributes(schema, attributeValues(item.Attributes), true); err != nil {
+		return fmt.Errorf("商品の属性が正しくありません: %v", err)
+	}
+	if sellerNeedsVerification(&item.Seller, item.Price, lifecycle.OnSale) {
+		return fmt.Errorf("%d円を超える商品を出品するには本人確認が必要です", verificationPriceThreshold())
+	}
+	return nil
+}
+
+// loadPublishableDraft 出品者本人の下書きを、公開の確認に必要な情報と合わせて取得する
+// 失敗時はレスポンスを書き込んで false を返す
+func loadPublishableDraft(c *gin.Context) (models.Item, bool) {
+	item, ok := loadOwnItem(c)
+	if !ok {
+		return item, false
+	}
+	if item.Status != lifecycle.Draft {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only drafts can be scheduled"})
+		return item, false
+	}
+	if err := database.DBClient.Preload("Seller").Preload("Images").Preload("Attributes").First(&item, item.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch item"})
+		return item, false
+	}
+	return item, true
+}
+
+// ScheduleItemHandler 下書きの公開日時を予約 (PUT /items/:id/schedule)
+// 予約時点でも出品の条件を確認し、公開時にもう一度確認する
+func ScheduleItemHandler(c *gin.Context) {
+	var req struct {
+		PublishAt time.Time `json:"publish_at" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "publish_at is required (RFC3339)"})
+		return
+	}
+	now := time.Now()
+	if !req.PublishAt.After(now) || req.PublishAt.After(now.Add(maxPublishSchedule)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "publish_at must be in the future and within 90 days"})
+		return
+	}
+
+	item, ok := loadPublishableDraft(c)
+	if !ok {
+		return
+	}
+	if err := validatePublishable(item); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := database.DBClient.Model(&models.Item{}).
+		Where("id = ? AND status = ?", item.ID, lifecycle.Draft).
+		Update("publish_at", req.PublishAt)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule item"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Item status was changed. Please reload and try again"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Item scheduled", "publish_at": req.PublishAt})
+}
+
+// UnscheduleItemHandler 予約出品を取り消す (DELETE /items/:id/schedule)
+func UnscheduleItemHandler(c *gin.Context) {
+	item, ok := loadOwnItem(c)
+	if !ok {
+		return
+	}
+	if err := database.DBClient.Model(&models.Item{}).
+		Where("id = ?", item.ID).
+		Update("publish_at", nil).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unschedule item"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Item unscheduled"})
+}
+
+// StartPublishScheduler 公開日時を過ぎた予約出品を interval ごとに公開するバックグラウンド処理を開始する
+func StartPublishScheduler(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			publishDueDrafts()
+		}
+	}()
+}
+
+// publishDueDrafts 公開日時を過ぎた下書きを ON_SALE にし、出品者のフォロワーに通知する
+// 出品の条件を満たさない場合は予約を取り消して出品者に知らせる
+func publishDueDrafts() {
+	now := time.Now()
+	var items []models.Item
+	if err := database.DBClient.
+		Preload("Seller").Preload("Images").Preload("Attributes").
+		Where("status = ? AND publish_at <= ?", lifecycle.Draft, now).
+		Limit(100).
+		Find(&items).Error; err != nil {
+		log.Printf("Publish scheduler: failed to fetch scheduled drafts: %v", err)
+		return
+	}
+
+	for _, item := range items {
+		var notifications []models.Notification
+		if reason := validatePublishable(item); reason != nil {
+			noti, err := cancelSchedule(item, reason)
+			if err != nil {
+				log.Printf("Publish scheduler: failed to cancel schedule of item %d: %v", item.ID, err)
+				continue
+			}
+			if noti != nil {
+				notifications = append(notifications, *noti)
+			}
+		} else {
+			err := database.DBClient.Transaction(func(tx *gorm.DB) (err error) {
+				// 確認後に出品者が予約を変更した場合は公開しない
+				if err := lifecycle.Move(tx.Where("publish_at <= ?", now), &item, lifecycle.OnSale, lifecycle.ActorSystem); err != nil {
+					return err
+				}
+				notifications, err = notifyFollowersOfNewItem(tx, item)
+				return err
+			})
+			switch {
+			case err == nil:
+				log.Printf("Publish scheduler: published item %d", item.ID)
+			case errors.Is(err, lifecycle.ErrConflict):
+				// 他の処理が先に変更した
+			default:
+				log.Printf("Publish scheduler: failed to publish item %d: %v", item.ID, err)
+			}
+		}
+		broadcastNotifications(notifications)
+	}
+}
+
+// cancelSchedule 公開できなかった予約出品を取り消し、出品者宛ての通知を作成する
+// 確認後に予約が変更されていた場合は何もせず nil を返す
+func cancelSchedule(item models.Item, reason error) (*models.Notification, error) {
+	var noti *models.Notification
+	err := database.DBClient.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Item{}).
+			Where("id = ? AND status = ? AND publish_at = ?", item.ID, lifecycle.Draft, item.PublishAt).
+			Update("publish_at", nil)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		noti = &models.Notification{
+			UserID:    item.SellerID,
+			Type:      "SYSTEM",
+			Content:   fmt.Sprintf("「%s」を予約出品できませんでした: %v", item.Title, reason),
+			RelatedID: item.ID,
+		}
+		return tx.Create(noti).Error
+	})
+	return noti, err
+}
+
+// notifyFollowersOfNewItem 出品者のフォロワー宛てに新着出品の通知を作成する
+// 出品者をミュート・ブロックしているユーザーには通知しない。WebSocket での送信はコミット後に呼び出し側で行う
+func notifyFollowersOfNewItem(tx *gorm.DB, item models.Item) ([]models.Notification, error) {
+	var followerIDs []uint64
+	if err := tx.Model(&models.Follow{}).
+		Where("following_id = ?", item.SellerID).
+		Where("follower_id NOT IN (SELECT user_id FROM user_blocks WHERE target_id = ?)", item.SellerID).
+		Pluck("follower_id", &followerIDs).Error; err != nil {
+		return nil, err
+	}
+	if len(followerIDs) == 0 {
+		return nil, nil
+	}
+
+	notifications := make([]models.Notification, len(followerIDs))
+	for i, followerID := range followerIDs {
+		notifications[i] = models.Notification{
+			UserID:    followerID,
+			Type:      "NEW_ITEM",
+			Content:   fmt.Sprintf("%sさんが「%s」を出品しました", item.Seller.Username, item.Title),
+			RelatedID: item.ID,
+		}
+	}
+	if err := tx.Create(&notifications).Error; err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Kousuke-irie/hackathon-backend/database"
+	"github.com/Kousuke-irie/hackathon-backend/lifecycle"
+	"github.com/Kousuke-irie/hackathon-backend/middleware"
+	"github.com/Kousuke-irie/hackathon-backend/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// loadOwnItem 商品を取得し、ログインユーザーが出品者であることを確認する
+// 失敗時はレスポンスを書き込んで false を返す
+func loadOwnItem(c *gin.Context) (models.Item, bool) {
+	var item models.Item
+	if err := database.DBClient.First(&item, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return item, false
+	}
+	if item.SellerID != middleware.CurrentUserID(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have permission to edit this item"})
+		return item, false
+	}
+	// オークション中の商品は入札者がいるため変更できない (入札がなければ取り消してから変更する)
+	if isOpenAuctionItem(item) {
+		c.JSON(http.StatusConflict, gin.H{"error": "オークション中の商品は変更できません", "code": "AUCTION_OPEN"})
+		return item, false
+	}
+	return item, true
+}
+
+// changeItemStatus 出品者として商品を to の状態に変更する
+func changeItemStatus(c *gin.Context, item models.Item, to string) {
+	from := item.Status
+	if !respondItemTransition(c, lifecycle.Move(database.DBClient, &item, to, lifecycle.ActorSeller), from, to) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Item updated", "item": item})
+}
+
+// respondItemTransition 状態遷移のエラーをレスポンスに変換する。成功時は true を返す
+func respondItemTransition(c *gin.Context, err error, from, to string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, lifecycle.ErrInvalidTransition), errors.Is(err, lifecycle.ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Item cannot be changed from %s to %s", from, to)})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update item"})
+	}
+	return false
+}
+
+// PauseItemHandler 出品を一時停止 (POST /items/:id/pause)
+// 一覧・スワイプ・購入の対象から外れるが、いいねは残る
+func PauseItemHandler(c *gin.Context) {
+	item, ok := loadOwnItem(c)
+	if !ok {
+		return
+	}
+	changeItemStatus(c, item, lifecycle.Paused)
+}
+
+// ResumeItemHandler 一時停止した出品を再開 (POST /items/:id/resume)
+func ResumeItemHandler(c *gin.Context) {
+	item, ok := loadOwnItem(c)
+	if !ok {
+		return
+	}
+	// 停止中に本人確認の条件が変わっている場合があるため再確認する
+	if item.Status == lifecycle.Paused && !requireVerifiedSellerForPrice(c, item.Price, lifecycle.OnSale) {
+		return
+	}
+	changeItemStatus(c, item, lifecycle.OnSale)
+}
+
+// ArchiveItemHandler 出品を取り下げてアーカイブ (POST /items/:id/archive)
+// 出品者の履歴には残り、編集して下書きに戻せる。いいねしたユーザーには通知する
+func ArchiveItemHandler(c *gin.Context) {
+	item, ok := loadOwnItem(c)
+	if !ok {
+		return
+	}
+
+	from := item.Status
+	var notifications []models.Notification
+	err := database.DBClient.Transaction(func(tx *gorm.DB) (err error) {
+		if err := lifecycle.Move(tx, &item, lifecycle.Archived, lifecycle.ActorSeller); err != nil {
+			return err
+		}
+		notifications, err = notifyLikers(tx, item, "「%s」は出品者により取り下げられました")
+		return err
+	})
+	if !respondItemTransition(c, err, from, lifecycle.Archived) {
+		return
+	}
+	broadcastNotifications(notifications)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Item archived", "item": item})
+}
+
+// DeleteItemHandler 出品を削除 (DELETE /items/:id)
+// 購入手続き中・売却済みの商品は取引記録のため削除できない。削除は論理削除で、いいねしたユーザーには通知する
+func DeleteItemHandler(c *gin.Context) {
+	item, ok := loadOwnItem(c)
+	if !ok {
+		return
+	}
+	if !lifecycle.CanDelete(item.Status) {
+		c.JSON(http.StatusConflict, gin.H{"error": "購入手続き中・売却済みの商品は削除できません"})
+		return
+	}
+	// 在庫が複数ある商品で数量を確保中の購入者がいる場合も、購入を確定できるよう削除しない
+	var holdCount int64
+	if err := database.DBClient.Model(&models.StockHold{}).Where("item_id = ?", item.ID).Count(&holdCount).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete item"})
+		return
+	}
+	if holdCount > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "購入手続き中・売却済みの商品は削除できません"})
+		return
+	}
+
+	var notifications []models.Notification
+	err := database.DBClient.Transaction(func(tx *gorm.DB) (err error) {
+		result := tx.Where("id = ? AND status = ?", item.ID, item.Status).Delete(&models.Item{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return lifecycle.ErrConflict
+		}
+		notifications, err = notifyLikers(tx, item, "「%s」は出品者により削除されました")
+		return err
+	})
+	if errors.Is(err, lifecycle.ErrConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Item status was changed. Please reload and try again"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete item"})
+		return
+	}
+	broadcastNotifications(notifications)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Item deleted"})
+}
+
+// notifyLikers 商品をいいねしていたユーザー宛ての通知を作成する
+// いいねの行は集計のため残す (出品中でない商品はいいね一覧側で除外される)。
+// format には商品名が1つ入る。WebSocket での送信はコミット後に呼び出し側で行う
+func notifyLikers(tx *gorm.DB, item models.Item, format string) ([]models.Notification, error) {
+	var userIDs []uint64
+	if err := tx.Model(&models.Like{}).
+		Where("item_id = ? AND reaction = ?", item.ID, "LIKE").
+		Distinct().Pluck("user_id", &userIDs).Error; err != nil {
+		return nil, err
+	}
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+
+	notifications := make([]models.Notification, len(userIDs))
+	for i, userID := range userIDs {
+		notifications[i] = models.Notification{
+			UserID:    userID,
+			Type:      "SYSTEM",
+			Content:   fmt.Sprintf(format, item.Title),
+			RelatedID: item.ID,
+		}
+	}
+	if err := tx.Create(&notifications).Error; err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+// broadcastNotifications 作成済みの通知をまとめて WebSocket で送信する
+func broadcastNotifications(notifications []models.Notification) {
+	for _, noti := range notifications {
+		BroadcastNotification(noti.UserID, noti)
+	}
+}
@@ -0,0 +1,379 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Kousuke-irie/hackathon-backend/database"
+	"github.com/Kousuke-irie/hackathon-backend/lifecycle"
+	"github.com/Kousuke-irie/hackathon-backend/middleware"
+	"github.com/Kousuke-irie/hackathon-backend/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	// offerResponseTTL 値下げ交渉・対案に相手が応答できる期間
+	offerResponseTTL = 24 * time.Hour
+	// offerPurchaseWindow 承諾された価格で購入できる期間
+	offerPurchaseWindow = 24 * time.Hour
+	// minOfferAmount 提示できる最低価格 (Stripe の日本円の最低決済額)
+	minOfferAmount = 50
+	// maxOfferMessageLength 値下げ交渉に添えるメッセージの最大文字数
+	maxOfferMessageLength = 200
+)
+
+// usedOfferIDs 購入に使われた (キャンセルされていない取引がある) 値下げ交渉の ID を返すサブクエリ
+const usedOfferIDs = "SELECT offer_id FROM transactions WHERE offer_id IS NOT NULL AND status <> 'CANCELED'"
+
+// isOfferOpen 値下げ交渉が応答待ちで、応答の期限内かを返す
+func isOfferOpen(offer models.Offer, now time.Time) bool {
+	return (offer.Status == models.OfferPending || offer.Status == models.OfferCountered) && offer.ExpiresAt.After(now)
+}
+
+// offerUnitPrice 承諾された値下げ交渉で購入する場合の単価 (承諾後に出品者が値下げした場合は安い方)
+func offerUnitPrice(item models.Item, offer models.Offer) int {
+	if amount := offer.AgreedAmount(); amount < item.Price {
+		return amount
+	}
+	return item.Price
+}
+
+// findUsableOffer 購入者がその商品を承諾された価格で購入できる値下げ交渉を返す (なければ nil)
+func findUsableOffer(itemID, buyerID uint64, now time.Time) (*models.Offer, error) {
+	var offer models.Offer
+	if err := database.DBClient.
+		Where("item_id = ? AND buyer_id = ? AND status = ? AND purchase_deadline > ?", itemID, buyerID, models.OfferAccepted, now).
+		Where("id NOT IN (" + usedOfferIDs + ")").
+		Order("id DESC").
+		Limit(1).
+		Find(&offer).Error; err != nil {
+		return nil, err
+	}
+	if offer.ID == 0 {
+		return nil, nil
+	}
+	return &offer, nil
+}
+
+// isOfferableItem 値下げ交渉の対象にできる商品かを返す (購入手続き中の商品は他の購入者の手続きが中止される可能性がある)
+// オークションの商品は入札で価格が決まるため対象外
+func isOfferableItem(item models.Item) bool {
+	return (item.Status == lifecycle.OnSale || item.Status == lifecycle.Reserved) && item.Stock > 0 && item.ListingType != models.ListingAuction
+}
+
+// loadParticipantOffer 値下げ交渉を商品と合わせて取得し、ログインユーザーが当事者であることを確認する
+// 失敗時はレスポンスを書き込んで false を返す
+func loadParticipantOffer(c *gin.Context) (models.Offer, string, bool) {
+	var offer models.Offer
+	if err := database.DBClient.Preload("Item").First(&offer, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Offer not found"})
+		return offer, "", false
+	}
+	role := ""
+	switch middleware.CurrentUserID(c) {
+	case offer.BuyerID:
+		role = "BUYER"
+	case offer.SellerID:
+		role = "SELLER"
+	}
+	if role == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a participant of this offer"})
+		return offer, "", false
+	}
+	return offer, role, true
+}
+
+// respondOffer 値下げ交渉の状態を from から updates の内容に更新し、相手への通知を送ってレスポンスを返す
+// 同時に応答された場合は 409 を返す
+func respondOffer(c *gin.Context, offer models.Offer, from string, updates map[string]interface{}, noti models.Notification) {
+	err := database.DBClient.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Offer{}).Where("id = ? AND status = ?", offer.ID, from).Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return lifecycle.ErrConflict
+		}
+		return tx.Create(&noti).Error
+	})
+	if err != nil {
+		if errors.Is(err, lifecycle.ErrConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Offer status was changed. Please reload and try again"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update offer"})
+		return
+	}
+	BroadcastNotification(noti.UserID, noti)
+
+	database.DBClient.First(&offer, offer.ID)
+	c.JSON(http.StatusOK, gin.H{"offer": offer})
+}
+
+// MakeOfferHandler 商品に値下げ交渉を申し込む (POST /items/:id/offers)
+func MakeOfferHandler(c *gin.Context) {
+	var req struct {
+		Amount  int    `json:"amount" binding:"required"`
+		Message string `json:"message"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount is required"})
+		return
+	}
+	req.Message = strings.TrimSpace(req.Message)
+	if utf8.RuneCountInString(req.Message) > maxOfferMessageLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("message must be at most %d characters", maxOfferMessageLength)})
+		return
+	}
+
+	var item models.Item
+	if err := database.DBClient.First(&item, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+	buyerID := middleware.CurrentUserID(c)
+	if item.SellerID == buyerID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "自分の商品には値下げ交渉できません"})
+		return
+	}
+	if isBlockedBetween(item.SellerID, buyerID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "この商品には値下げ交渉できません"})
+		return
+	}
+	if !isOfferableItem(item) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This item is not on sale"})
+		return
+	}
+	if req.Amount < minOfferAmount || req.Amount >= item.Price {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("提示価格は%d円以上、販売価格未満で指定してください", minOfferAmount)})
+		return
+	}
+
+	// 応答待ちの交渉や、承諾されてまだ購入していない交渉がある場合は新しく申し込めない
+	now := time.Now()
+	var activeCount int64
+	if err := database.DBClient.Model(&models.Offer{}).
+		Where("item_id = ? AND buyer_id = ?", item.ID, buyerID).
+		Where("(status IN ? AND expires_at > ?) OR (status = ? AND purchase_deadline > ? AND id NOT IN ("+usedOfferIDs+"))",
+			[]string{models.OfferPending, models.OfferCountered}, now, models.OfferAccepted, now).
+		Count(&activeCount).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to make offer"})
+		return
+	}
+	if activeCount > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "この商品には交渉中の値下げ交渉があります"})
+		return
+	}
+
+	offer := models.Offer{
+		ItemID:    item.ID,
+		BuyerID:   buyerID,
+		SellerID:  item.SellerID,
+		Amount:    req.Amount,
+		Message:   req.Message,
+		Status:    models.OfferPending,
+		ExpiresAt: now.Add(offerResponseTTL),
+	}
+	noti := models.Notification{
+		UserID:    item.SellerID,
+		Type:      "OFFER_RECEIVED",
+		Content:   fmt.Sprintf("「%s」に%d円で値下げ交渉が届きました", item.Title, req.Amount),
+		RelatedID: item.ID,
+	}
+	if err := database.DBClient.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&offer).Error; err != nil {
+			return err
+		}
+		return tx.Create(&noti).Error
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create offer"})
+		return
+	}
+	BroadcastNotification(noti.UserID, noti)
+
+	c.JSON(http.StatusCreated, gin.H{"offer": offer})
+}
+
+// CounterOfferHandler 出品者が値下げ交渉に対案を提示する (POST /offers/:id/counter)
+func CounterOfferHandler(c *gin.Context) {
+	var req struct {
+		Amount int `json:"amount" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount is required"})
+		return
+	}
+
+	offer, role, ok := loadParticipantOffer(c)
+	if !ok {
+		return
+	}
+	if role != "SELLER" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "対案を提示できるのは出品者のみです"})
+		return
+	}
+	if offer.Status != models.OfferPending || !isOfferOpen(offer, time.Now()) {
+		c.JSON(http.StatusConflict, gin.H{"error": "この値下げ交渉には応答できません"})
+		return
+	}
+	if !isOfferableItem(offer.Item) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This item is not on sale"})
+		return
+	}
+	if req.Amount <= offer.Amount || req.Amount >= offer.Item.Price {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "対案の価格は提示価格より高く、販売価格未満で指定してください"})
+		return
+	}
+
+	respondOffer(c, offer, models.OfferPending, map[string]interface{}{
+		"status":         models.OfferCountered,
+		"counter_amount": req.Amount,
+		"expires_at":     time.Now().Add(offerResponseTTL),
+	}, models.Notification{
+		UserID:    offer.BuyerID,
+		Type:      "OFFER_COUNTERED",
+		Content:   fmt.Sprintf("「%s」の値下げ交渉に出品者から%d円の提案が届きました", offer.Item.Title, req.Amount),
+		RelatedID: offer.ItemID,
+	})
+}
+
+// AcceptOfferHandler 値下げ交渉を承諾する (POST /offers/:id/accept)
+// 出品者は購入者の提示価格を、購入者は出品者の対案を承諾できる。承諾後は購入期限までその価格で購入できる
+func AcceptOfferHandler(c *gin.Context) {
+	offer, role, ok := loadParticipantOffer(c)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	if !isOfferOpen(offer, now) ||
+		(role == "SELLER" && offer.Status != models.OfferPending) ||
+		(role == "BUYER" && offer.Status != models.OfferCountered) {
+		c.JSON(http.StatusConflict, gin.H{"error": "この値下げ交渉には応答できません"})
+		return
+	}
+	if !isOfferableItem(offer.Item) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This item is not on sale"})
+		return
+	}
+
+	deadline := now.Add(offerPurchaseWindow)
+	noti := models.Notification{
+		UserID:    offer.BuyerID,
+		Type:      "OFFER_ACCEPTED",
+		Content:   fmt.Sprintf("「%s」の値下げ交渉が承諾されました。%d円で購入できます", offer.Item.Title, offer.AgreedAmount()),
+		RelatedID: offer.ItemID,
+	}
+	if role == "BUYER" {
+		noti.UserID = offer.SellerID
+		noti.Content = fmt.Sprintf("「%s」の%d円の提案が承諾されました", offer.Item.Title, offer.AgreedAmount())
+	}
+	respondOffer(c, offer, offer.Status, map[string]interface{}{
+		"status":            models.OfferAccepted,
+		"accepted_at":       now,
+		"purchase_deadline": deadline,
+	}, noti)
+}
+
+// DeclineOfferHandler 値下げ交渉を断る (POST /offers/:id/decline)
+// 出品者は応答待ちの交渉を、購入者は出品者の対案を断れる。購入者は応答待ちの自分の交渉を取り下げることもできる
+func DeclineOfferHandler(c *gin.Context) {
+	offer, role, ok := loadParticipantOffer(c)
+	if !ok {
+		return
+	}
+	if !isOfferOpen(offer, time.Now()) || (role == "SELLER" && offer.Status != models.OfferPending) {
+		c.JSON(http.StatusConflict, gin.H{"error": "この値下げ交渉には応答できません"})
+		return
+	}
+
+	noti := models.Notification{
+		UserID:    offer.BuyerID,
+		Type:      "OFFER_DECLINED",
+		Content:   fmt.Sprintf("「%s」の値下げ交渉は見送られました", offer.Item.Title),
+		RelatedID: offer.ItemID,
+	}
+	if role == "BUYER" {
+		noti.UserID = offer.SellerID
+		noti.Content = fmt.Sprintf("「%s」の値下げ交渉が取り下げられました", offer.Item.Title)
+	}
+	respondOffer(c, offer, offer.Status, map[string]interface{}{"status": models.OfferDeclined}, noti)
+}
+
+// GetItemOffersHandler 商品の値下げ交渉の一覧を取得 (GET /items/:id/offers)
+// 出品者にはすべての交渉を、それ以外のユーザーには自分の交渉のみを返す
+func GetItemOffersHandler(c *gin.Context) {
+	var item models.Item
+	if err := database.DBClient.First(&item, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+
+	userID := middleware.CurrentUserID(c)
+	query := database.DBClient.Where("item_id = ?", item.ID)
+	if item.SellerID == userID {
+		query = query.Preload("Buyer")
+	} else {
+		query = query.Where("buyer_id = ?", userID)
+	}
+
+	var offers []models.Offer
+	if err := query.Order("created_at DESC").Find(&offers).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch offers"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"offers": offers})
+}
+
+// GetMyOffersHandler 自分の値下げ交渉の一覧を取得 (GET /my/offers?role=buyer|seller)
+func GetMyOffersHandler(c *gin.Context) {
+	userID := middleware.CurrentUserID(c)
+	query := database.DBClient.Preload("Item")
+	if c.DefaultQuery("role", "buyer") == "seller" {
+		query = query.Preload("Buyer").Where("seller_id = ?", userID)
+	} else {
+		query = query.Where("buyer_id = ?", userID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var offers []models.Offer
+	if err := query.Order("created_at DESC").Limit(100).Find(&offers).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch offers"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"offers": offers})
+}
+
+// StartOfferSweeper 期限切れの値下げ交渉を interval ごとに EXPIRED にするバックグラウンド処理を開始する
+func StartOfferSweeper(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			expireOffers()
+		}
+	}()
+}
+
+// expireOffers 応答の期限を過ぎた交渉と、購入期限までに購入されなかった承諾済みの交渉を EXPIRED にする
+func expireOffers() {
+	now := time.Now()
+	if err := database.DBClient.Model(&models.Offer{}).
+		Where("status IN ? AND expires_at <= ?", []string{models.OfferPending, models.OfferCountered}, now).
+		Update("status", models.OfferExpired).Error; err != nil {
+		log.Printf("Offer sweeper: failed to expire open offers: %v", err)
+	}
+	if err := database.DBClient.Model(&models.Offer{}).
+		Where("status = ? AND purchase_deadline <= ?", models.OfferAccepted, now).
+		Where("id NOT IN ("+usedOfferIDs+")").
+		Update("status", models.OfferExpired).Error; err != nil {
+		log.Printf("Offer sweeper: failed to expire accepted offers: %v", err)
+	}
+}
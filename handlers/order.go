@@ -0,0 +1,637 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Kousuke-irie/hackathon-backend/database"
+	"github.com/Kousuke-irie/hackathon-backend/lifecycle"
+	"github.com/Kousuke-irie/hackathon-backend/middleware"
+	"github.com/Kousuke-irie/hackathon-backend/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stripe/stripe-go/v79"
+	"github.com/stripe/stripe-go/v79/paymentintent"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxOrderItems 1つの注文にまとめられる商品数の上限 (出品者の送料ルールでさらに絞れる)
+const maxOrderItems = 20
+
+// orderStatusTransitions 注文の状態の更新 (更新後の状態 → 更新前の状態と更新できる当事者)
+var orderStatusTransitions = map[string]struct {
+	From string
+	Role string
+}{
+	models.OrderShipped:   {models.OrderPurchased, "SELLER"},
+	models.OrderCompleted: {models.OrderShipped, "BUYER"},
+}
+
+// isOrderPaymentIntent 決済インテントがまとめ買いの注文のものかを返す
+func isOrderPaymentIntent(paymentIntentID string) bool {
+	if paymentIntentID == "" {
+		return false
+	}
+	var count int64
+	database.DBClient.Model(&models.Order{}).Where("payment_intent_id = ?", paymentIntentID).Count(&count)
+	return count > 0
+}
+
+// cancelPendingOrder 決済待ちの注文を取り消し、同じ決済インテントで確保していた商品をすべて解放する
+// 注文の商品の予約が1つでも解放されたときに呼び出す (まとめ買いの予約はすべて揃っているか、すべて解放されているかのどちらか)
+func cancelPendingOrder(paymentIntentID string) {
+	result := database.DBClient.Model(&models.Order{}).
+		Where("payment_intent_id = ? AND status = ?", paymentIntentID, models.OrderPending).
+		Update("status", models.OrderCanceled)
+	if result.Error != nil {
+		log.Printf("Failed to cancel pending order of payment intent %s: %v", paymentIntentID, result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+
+	var items []models.Item
+	if err := database.DBClient.Where("status = ? AND payment_intent_id = ?", lifecycle.Reserved, paymentIntentID).Find(&items).Error; err != nil {
+		log.Printf("Failed to fetch reserved items of payment intent %s: %v", paymentIntentID, err)
+		return
+	}
+	for _, item := range items {
+		if err := releaseReservation(item, lifecycle.ActorSystem); err != nil && !errors.Is(err, lifecycle.ErrConflict) {
+			log.Printf("Failed to release item %d of canceled order: %v", item.ID, err)
+		}
+	}
+}
+
+// releaseOrderReservations 決済待ちの注文の予約をすべて解放して注文を取り消す
+// 決済が完了済みの場合は解放せず errPaymentAlreadySucceeded を返す
+func releaseOrderReservations(order models.Order, actor lifecycle.Actor) error {
+	var items []models.Item
+	if err := database.DBClient.
+		Where("id IN ? AND status = ? AND reserved_by_id = ? AND payment_intent_id = ?", order.ItemIDs, lifecycle.Reserved, order.BuyerID, order.PaymentIntentID).
+		Find(&items).Error; err != nil {
+		return err
+	}
+	for _, item := range items {
+		if err := releaseReservation(item, actor); err != nil && !errors.Is(err, lifecycle.ErrConflict) {
+			return err
+		}
+	}
+	// 決済インテントを作る前に失敗した場合など、解放で取り消されなかった注文もここで取り消す
+	return database.DBClient.Model(&models.Order{}).
+		Where("id = ? AND status = ?", order.ID, models.OrderPending).
+		Update("status", models.OrderCanceled).Error
+}
+
+// loadParticipantOrder 注文を取得し、ログインユーザーが当事者であることを確認する
+// 失敗時はレスポンスを書き込んで false を返す
+func loadParticipantOrder(c *gin.Context) (models.Order, string, bool) {
+	var order models.Order
+	if err := database.DBClient.First(&order, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return order, "", false
+	}
+	role := ""
+	switch middleware.CurrentUserID(c) {
+	case order.BuyerID:
+		role = "BUYER"
+	case order.SellerID:
+		role = "SELLER"
+	}
+	if role == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a participant of this order"})
+		return order, "", false
+	}
+	return order, role, true
+}
+
+// uniqueIDs 重複を取り除いた ID の一覧を返す (順序は保つ)
+func uniqueIDs(ids []uint64) []uint64 {
+	seen := make(map[uint64]bool, len(ids))
+	result := make([]uint64, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// CreateOrderHandler まとめ買いの手続きを開始する (POST /orders)
+// 同じ出品者の商品をすべて確保できた場合のみ、送料を含めた合計額で1つの決済インテントを作成する
+func CreateOrderHandler(c *gin.Context) {
+	var req struct {
+		ItemIDs   []uint64 `json:"item_ids" binding:"required"`
+		AddressID uint64   `json:"address_id"` // 省略時は既定の住所
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "item_ids is required"})
+		return
+	}
+	itemIDs := uniqueIDs(req.ItemIDs)
+	if len(itemIDs) < 2 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "まとめ買いには2点以上の商品を指定してください"})
+		return
+	}
+	if len(itemIDs) > maxOrderItems {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("まとめ買いできるのは%d点までです", maxOrderItems)})
+		return
+	}
+
+	var items []models.Item
+	if err := database.DBClient.Where("id IN ?", itemIDs).Find(&items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch items"})
+		return
+	}
+	if len(items) != len(itemIDs) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+
+	buyerID := middleware.CurrentUserID(c)
+	sellerID := items[0].SellerID
+	for _, item := range items {
+		if item.SellerID != sellerID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "まとめ買いできるのは同じ出品者の商品のみです"})
+			return
+		}
+	}
+	if sellerID == buyerID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "自分の商品は購入できません"})
+		return
+	}
+	if isBlockedBetween(sellerID, buyerID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "この商品は購入できません"})
+		return
+	}
+
+	rule, err := loadShippingRule(sellerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shipping rule"})
+		return
+	}
+	if rule.MaxItems > 0 && len(items) > rule.MaxItems {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("この出品者のまとめ買いは%d点までです", rule.MaxItems)})
+		return
+	}
+
+	// 決済前に配送先が決まっていることを確認する
+	address, err := resolveShippingAddress(buyerID, req.AddressID)
+	if err != nil {
+		respondShippingAddressError(c, err)
+		return
+	}
+
+	configureStripe()
+	now := time.Now()
+
+	// 期限切れの予約と自分の以前の手続きは解放してから取り直す
+	unavailable := []uint64{}
+	for i, item := range items {
+		if item.Status == lifecycle.Reserved && (isReservedBy(item, buyerID) || reservationExpired(item, now)) {
+			if err := releaseReservation(item, lifecycle.ActorSystem); err != nil && !errors.Is(err, lifecycle.ErrConflict) {
+				if !errors.Is(err, errPaymentAlreadySucceeded) {
+					fmt.Printf("Release Reservation Error: %v\n", err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
+					return
+				}
+			}
+			if err := database.DBClient.First(&items[i], item.ID).Error; err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+				return
+			}
+		}
+		if items[i].Status != lifecycle.OnSale || items[i].Stock < 1 || items[i].ListingType == models.ListingAuction {
+			unavailable = append(unavailable, item.ID)
+		}
+	}
+	if len(unavailable) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "購入できない商品が含まれています", "code": "ITEMS_UNAVAILABLE", "item_ids": unavailable})
+		return
+	}
+
+	subtotal := 0
+	for _, item := range items {
+		subtotal += item.Price
+	}
+	shippingFee := rule.Fee(subtotal, len(items))
+	order := models.Order{
+		BuyerID:         buyerID,
+		SellerID:        sellerID,
+		Status:          models.OrderPending,
+		ItemIDs:         itemIDs,
+		Subtotal:        subtotal,
+		ShippingFee:     shippingFee,
+		Total:           subtotal + shippingFee,
+		ShippingAddress: address.Snapshot(),
+	}
+
+	// 💡 すべての商品を1つのトランザクションで確保する。1点でも確保できなければ何も確保しない
+	reservedUntil := now.Add(reservationTTL())
+	err = database.DBClient.Transaction(func(tx *gorm.DB) error {
+		for i := range items {
+			if err := lifecycle.MoveWith(tx, &items[i], lifecycle.Reserved, lifecycle.ActorBuyer, map[string]interface{}{
+				"reserved_by_id":    buyerID,
+				"reserved_until":    reservedUntil,
+				"payment_intent_id": "",
+				"reserved_quantity": 1,
+			}); err != nil {
+				return err
+			}
+		}
+		return tx.Create(&order).Error
+	})
+	if err != nil {
+		if errors.Is(err, lifecycle.ErrConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": "他のユーザーが購入手続き中の商品が含まれています", "code": "ITEMS_UNAVAILABLE"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reserve items"})
+		return
+	}
+
+	// 支払いインテント作成 (送料を含めた合計額を1回で決済)
+	params := &stripe.PaymentIntentParams{
+		Amount:   stripe.Int64(int64(order.Total)),
+		Currency: stripe.String(string(stripe.CurrencyJPY)),
+		AutomaticPaymentMethods: &stripe.PaymentIntentAutomaticPaymentMethodsParams{
+			Enabled: stripe.Bool(true),
+		},
+	}
+	params.AddMetadata("order_id", strconv.FormatUint(order.ID, 10))
+	params.AddMetadata("buyer_id", strconv.FormatUint(buyerID, 10))
+
+	pi, err := paymentintent.New(params)
+	if err != nil {
+		// 決済を開始できなかったので確保した商品を戻す
+		if releaseErr := releaseOrderReservations(order, lifecycle.ActorSystem); releaseErr != nil {
+			fmt.Printf("Release Reservation Error: %v\n", releaseErr)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment intent"})
+		return
+	}
+
+	// 予約と注文を決済インテントに結びつける。1点でも結びつけられない場合は注文を確定できないため、決済インテントを取り消して予約を戻す
+	err = database.DBClient.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Item{}).
+			Where("id IN ? AND status = ? AND reserved_by_id = ? AND payment_intent_id = ''", itemIDs, lifecycle.Reserved, buyerID).
+			Update("payment_intent_id", pi.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != int64(len(itemIDs)) {
+			return lifecycle.ErrConflict
+		}
+		return tx.Model(&order).Update("payment_intent_id", pi.ID).Error
+	})
+	if err != nil {
+		fmt.Printf("Reservation Intent Error: %v\n", err)
+		order.PaymentIntentID = ""
+		if _, cancelErr := paymentintent.Cancel(pi.ID, nil); cancelErr != nil {
+			fmt.Printf("Cancel Payment Intent Error: %v\n", cancelErr)
+		}
+		if releaseErr := releaseOrderReservations(order, lifecycle.ActorSystem); releaseErr != nil {
+			fmt.Printf("Release Reservation Error: %v\n", releaseErr)
+		}
+		if errors.Is(err, lifecycle.ErrConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": "購入手続きが期限切れです。もう一度お試しください", "code": "RESERVATION_EXPIRED"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment intent"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"clientSecret":  pi.ClientSecret,
+		"reservedUntil": reservedUntil,
+		"order":         order,
+	})
+}
+
+// CompleteOrderHandler まとめ買いの購入を確定し、商品ごとの取引を作成する (POST /orders/:id/complete)
+func CompleteOrderHandler(c *gin.Context) {
+	order, role, ok := loadParticipantOrder(c)
+	if !ok {
+		return
+	}
+	if role != "BUYER" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "購入を確定できるのは購入者のみです"})
+		return
+	}
+	if order.Status != models.OrderPending || order.PaymentIntentID == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "この注文は決済待ちではありません"})
+		return
+	}
+
+	// 💡 注文の決済インテントの支払いが完了している場合のみ確定する
+	configureStripe()
+	pi, err := paymentintent.Get(order.PaymentIntentID, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payment intent"})
+		return
+	}
+	if pi.Status != stripe.PaymentIntentStatusSucceeded {
+		c.JSON(http.StatusConflict, gin.H{"error": "支払いが完了していません", "payment_status": pi.Status})
+		return
+	}
+
+	tx := database.DBClient.Begin()
+
+	// 確認から確定までに予約が解放されないよう、商品の行をロックして読み直す
+	var items []models.Item
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id IN ?", order.ItemIDs).Find(&items).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch items"})
+		return
+	}
+	expired := len(items) != len(order.ItemIDs)
+	for _, item := range items {
+		if !isReservedBy(item, order.BuyerID) || item.PaymentIntentID != order.PaymentIntentID {
+			expired = true
+		}
+	}
+	if expired {
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{"error": "購入手続きが期限切れです"})
+		return
+	}
+
+	transactions := make([]models.Transaction, 0, len(items))
+	for i := range items {
+		item := &items[i]
+		next := lifecycle.OnSale
+		if item.Stock-1 <= 0 {
+			next = lifecycle.Sold
+		}
+		guard := tx.Where("reserved_by_id = ? AND stock >= ?", order.BuyerID, 1)
+		if err := lifecycle.MoveWith(guard, item, next, lifecycle.ActorBuyer, map[string]interface{}{
+			"stock":             gorm.Expr("stock - ?", 1),
+			"reserved_by_id":    nil,
+			"reserved_until":    nil,
+			"payment_intent_id": "",
+			"reserved_quantity": 0,
+		}); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusConflict, gin.H{"error": "購入手続きが期限切れです"})
+			return
+		}
+
+		revision, err := recordItemRevision(tx, item.ID, item.SellerID)
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "取引の作成に失敗しました"})
+			return
+		}
+		transactions = append(transactions, models.Transaction{
+			ItemID:          item.ID,
+			BuyerID:         order.BuyerID,
+			SellerID:        order.SellerID,
+			PriceSnapshot:   item.Price,
+			Quantity:        1,
+			StripePaymentID: order.PaymentIntentID,
+			ItemRevisionID:  &revision.ID,
+			OrderID:         &order.ID,
+			Status:          models.OrderPurchased,
+			ShippingAddress: order.ShippingAddress,
+		})
+	}
+	if err := tx.Create(&transactions).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "取引の作成に失敗しました"})
+		return
+	}
+
+	result := tx.Model(&models.Order{}).
+		Where("id = ? AND status = ?", order.ID, models.OrderPending).
+		Update("status", models.OrderPurchased)
+	if result.Error != nil || result.RowsAffected == 0 {
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{"error": "Order status was changed. Please reload and try again"})
+		return
+	}
+
+	tx.Commit()
+
+	// 出品者への通知
+	noti := models.Notification{
+		UserID:    order.SellerID,
+		Type:      "ORDER_SOLD",
+		Content:   fmt.Sprintf("祝！「%s」など%d点がまとめ買いされました。まとめて発送をお願いします", items[0].Title, len(items)),
+		RelatedID: order.ID,
+	}
+	database.DBClient.Create(&noti)
+	BroadcastNotification(order.SellerID, noti)
+
+	transactionIDs := make([]uint64, len(transactions))
+	for i, t := range transactions {
+		transactionIDs[i] = t.ID
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "Order completed",
+		"order_id":        order.ID,
+		"transaction_ids": transactionIDs,
+	})
+}
+
+// CancelOrderHandler まとめ買いの注文をキャンセル (POST /orders/:id/cancel)
+// 決済待ちの注文は購入者のみが中止でき、購入済みの注文は発送前であれば当事者のどちらでもキャンセルできる
+func CancelOrderHandler(c *gin.Context) {
+	order, role, ok := loadParticipantOrder(c)
+	if !ok {
+		return
+	}
+
+	switch order.Status {
+	case models.OrderPending:
+		if role != "BUYER" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "決済待ちの注文は購入者のみが中止できます"})
+			return
+		}
+		switch err := releaseOrderReservations(order, lifecycle.ActorBuyer); {
+		case err == nil:
+			c.JSON(http.StatusOK, gin.H{"message": "Checkout canceled"})
+		case errors.Is(err, errPaymentAlreadySucceeded):
+			c.JSON(http.StatusConflict, gin.H{"error": "決済が完了しているため中止できません"})
+		default:
+			fmt.Printf("Cancel Order Error: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel order"})
+		}
+		return
+	case models.OrderPurchased:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cancellation is not allowed for shipped or completed orders."})
+		return
+	}
+
+	db := database.DBClient.Begin()
+
+	// 同時にキャンセルされても在庫を二重に戻さないよう、確認した状態からのみ更新
+	result := db.Model(&models.Order{}).
+		Where("id = ? AND status = ?", order.ID, models.OrderPurchased).
+		Update("status", models.OrderCanceled)
+	if result.Error != nil {
+		db.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel order"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		db.Rollback()
+		c.JSON(http.StatusConflict, gin.H{"error": "Order status was changed. Please reload and try again"})
+		return
+	}
+
+	var transactions []models.Transaction
+	if err := db.Where("order_id = ? AND status = ?", order.ID, models.OrderPurchased).Find(&transactions).Error; err != nil {
+		db.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel order"})
+		return
+	}
+	for _, t := range transactions {
+		if err := restockCanceledTransaction(db, t); err != nil {
+			db.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "商品の再販設定失敗"})
+			return
+		}
+	}
+	if err := db.Model(&models.Transaction{}).
+		Where("order_id = ? AND status = ?", order.ID, models.OrderPurchased).
+		Update("status", models.OrderCanceled).Error; err != nil {
+		db.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel order"})
+		return
+	}
+
+	db.Commit()
+
+	// キャンセルしなかった側の当事者に通知
+	recipientID := order.SellerID
+	if role == "SELLER" {
+		recipientID = order.BuyerID
+	}
+	noti := models.Notification{
+		UserID:    recipientID,
+		Type:      "ORDER_CANCELED",
+		Content:   fmt.Sprintf("まとめ買いの注文 (%d点) がキャンセルされました", len(order.ItemIDs)),
+		RelatedID: order.ID,
+	}
+	database.DBClient.Create(&noti)
+	BroadcastNotification(recipientID, noti)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Order canceled successfully"})
+}
+
+// UpdateOrderStatusHandler まとめ買いの注文のステータスを更新 (PUT /orders/:id/status)
+// 出品者は PURCHASED → SHIPPED、購入者は SHIPPED → COMPLETED に更新でき、注文の取引もすべて同じ状態にする
+func UpdateOrderStatusHandler(c *gin.Context) {
+	var req struct {
+		NewStatus string `json:"new_status" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+		return
+	}
+	transition, known := orderStatusTransitions[req.NewStatus]
+	if !known {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+		return
+	}
+
+	order, role, ok := loadParticipantOrder(c)
+	if !ok {
+		return
+	}
+	if role != transition.Role {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have permission to update this order to " + req.NewStatus})
+		return
+	}
+	if order.Status != transition.From {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Order must be %s to become %s", transition.From, req.NewStatus)})
+		return
+	}
+
+	err := database.DBClient.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Order{}).
+			Where("id = ? AND status = ?", order.ID, transition.From).
+			Update("status", req.NewStatus)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return lifecycle.ErrConflict
+		}
+		return tx.Model(&models.Transaction{}).
+			Where("order_id = ? AND status = ?", order.ID, transition.From).
+			Update("status", req.NewStatus).Error
+	})
+	if err != nil {
+		if errors.Is(err, lifecycle.ErrConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Order status was changed. Please reload and try again"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update status"})
+		return
+	}
+
+	if req.NewStatus == models.OrderShipped {
+		noti := models.Notification{
+			UserID:    order.BuyerID,
+			Type:      "ORDER_SHIPPED",
+			Content:   fmt.Sprintf("まとめ買いの商品 (%d点) が発送されました。到着までお待ちください", len(order.ItemIDs)),
+			RelatedID: order.ID,
+		}
+		database.DBClient.Create(&noti)
+		BroadcastNotification(order.BuyerID, noti)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Status updated", "new_status": req.NewStatus})
+}
+
+// GetOrderDetailHandler まとめ買いの注文の詳細を取得 (GET /orders/:id)
+func GetOrderDetailHandler(c *gin.Context) {
+	current, role, ok := loadParticipantOrder(c)
+	if !ok {
+		return
+	}
+
+	var order models.Order
+	if err := database.DBClient.
+		Preload("Transactions").
+		Preload("Transactions.Item").
+		Preload("Buyer").
+		Preload("Seller").
+		First(&order, current.ID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	response := gin.H{"order": order}
+	// 配送先は発送する出品者にのみ返す
+	if role == "SELLER" {
+		response["shipping_address"] = order.ShippingAddress
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetMyOrdersHandler 自分のまとめ買いの注文の一覧を取得 (GET /my/orders?role=buyer|seller)
+// 出品者には決済待ちの注文は表示しない
+func GetMyOrdersHandler(c *gin.Context) {
+	userID := middleware.CurrentUserID(c)
+	query := database.DBClient.Preload("Transactions").Preload("Transactions.Item")
+	if c.DefaultQuery("role", "buyer") == "seller" {
+		query = query.Where("seller_id = ? AND status <> ?", userID, models.OrderPending)
+	} else {
+		query = query.Where("buyer_id = ?", userID)
+	}
+
+	var orders []models.Order
+	if err := query.Order("created_at DESC").Limit(50).Find(&orders).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"orders": orders})
+}
@@ -1,28 +1,42 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
-	"os"
 	"strconv"
+	"time"
 
 	"github.com/Kousuke-irie/hackathon-backend/database"
+	"github.com/Kousuke-irie/hackathon-backend/lifecycle"
+	"github.com/Kousuke-irie/hackathon-backend/middleware"
 	"github.com/Kousuke-irie/hackathon-backend/models"
 	"github.com/gin-gonic/gin"
 	"github.com/stripe/stripe-go/v79"
 	"github.com/stripe/stripe-go/v79/paymentintent"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // CreatePaymentIntentHandler 支払い情報の作成
 func CreatePaymentIntentHandler(c *gin.Context) {
 	// どの商品を買うか受け取る
 	var req struct {
-		ItemID uint64 `json:"item_id"`
+		ItemID    uint64 `json:"item_id"`
+		AddressID uint64 `json:"address_id"` // 省略時は既定の住所
+		Quantity  int    `json:"quantity"`   // 購入する数量。省略時は 1
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
+	if req.Quantity == 0 {
+		req.Quantity = 1
+	}
+	if req.Quantity < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quantity"})
+		return
+	}
 
 	// 商品情報をDBから取得（価格を確認するため）
 	var item models.Item
@@ -31,18 +45,213 @@ func CreatePaymentIntentHandler(c *gin.Context) {
 		return
 	}
 
+	buyerID := middleware.CurrentUserID(c)
+
+	// 自分の出品物は購入できない
+	if item.SellerID == buyerID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "自分の商品は購入できません"})
+		return
+	}
+	// オークションの商品は入札で購入する
+	if item.ListingType == models.ListingAuction {
+		c.JSON(http.StatusConflict, gin.H{"error": "オークションの商品は入札で購入してください", "code": "AUCTION_ITEM"})
+		return
+	}
+	// ブロック関係にある出品者の商品は購入できない
+	if isBlockedBetween(item.SellerID, buyerID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "この商品は購入できません"})
+		return
+	}
+
+	// 決済前に配送先を決め、購入の確定まで予約に保存しておく
+	address, err := resolveShippingAddress(buyerID, req.AddressID)
+	if err != nil {
+		respondShippingAddressError(c, err)
+		return
+	}
+
+	// Stripeの設定
+	configureStripe()
+	now := time.Now()
+
+	// 承諾された値下げ交渉があれば、提示した購入者本人が購入期限内に1点購入する場合のみその価格で請求する
+	unitPrice := item.Price
+	var offerID *uint64
+	offer, err := findUsableOffer(item.ID, buyerID, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment intent"})
+		return
+	}
+	if offer != nil && req.Quantity == 1 {
+		unitPrice = offerUnitPrice(item, *offer)
+		offerID = &offer.ID
+	}
+
+	// 在庫が複数ある商品で数量を確保済みの場合も、同じ手続きであれば同じ決済インテントを返す
+	if hold, ok := findStockHold(item.ID, buyerID); ok {
+		if hold.ReservedUntil.After(now) && hold.PaymentIntentID != "" && hold.Quantity == req.Quantity &&
+			sameOffer(hold.OfferID, offerID) && hold.AddressID == address.ID {
+			if pi, err := paymentintent.Get(hold.PaymentIntentID, nil); err == nil && pi.Status != stripe.PaymentIntentStatusCanceled {
+				c.JSON(http.StatusOK, gin.H{
+					"clientSecret":  pi.ClientSecret,
+					"reservedUntil": hold.ReservedUntil,
+				})
+				return
+			}
+		}
+		// 期限切れ・数量などの変更は在庫に戻してから取り直す
+		if err := releaseStockHold(hold); err != nil && !errors.Is(err, lifecycle.ErrConflict) {
+			if errors.Is(err, errPaymentAlreadySucceeded) {
+				c.JSON(http.StatusConflict, gin.H{"error": "この商品は決済処理中です", "code": "ITEM_RESERVED"})
+				return
+			}
+			fmt.Printf("Release Stock Hold Error: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment intent"})
+			return
+		}
+		if err := database.DBClient.First(&item, req.ItemID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+			return
+		}
+	}
+
+	if item.Status == lifecycle.Reserved {
+		// 自分の手続き中で数量・値下げ交渉・配送先も同じであれば、同じ決済インテントを返す (画面の再読み込みなど)
+		// まとめ買いの手続き中の商品は、解放してから単品の手続きを取り直す
+		if isReservedBy(item, buyerID) && !reservationExpired(item, now) && item.PaymentIntentID != "" && item.ReservedQuantity == req.Quantity &&
+			sameOffer(item.ReservedOfferID, offerID) && item.ReservedAddressID != nil && *item.ReservedAddressID == address.ID &&
+			!isOrderPaymentIntent(item.PaymentIntentID) {
+			if pi, err := paymentintent.Get(item.PaymentIntentID, nil); err == nil && pi.Status != stripe.PaymentIntentStatusCanceled {
+				c.JSON(http.StatusOK, gin.H{
+					"clientSecret":  pi.ClientSecret,
+					"reservedUntil": item.ReservedUntil,
+				})
+				return
+			}
+		}
+		// 他の購入者が手続き中
+		if !isReservedBy(item, buyerID) && !reservationExpired(item, now) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":          "他のユーザーが購入手続き中です",
+				"code":           "ITEM_RESERVED",
+				"reserved_until": item.ReservedUntil,
+			})
+			return
+		}
+		// 期限切れ (または自分の古い手続き・数量の変更) は解放してから取り直す
+		if err := releaseReservation(item, lifecycle.ActorSystem); err != nil && !errors.Is(err, lifecycle.ErrConflict) {
+			if errors.Is(err, errPaymentAlreadySucceeded) {
+				c.JSON(http.StatusConflict, gin.H{"error": "この商品は決済処理中です", "code": "ITEM_RESERVED"})
+				return
+			}
+			fmt.Printf("Release Reservation Error: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment intent"})
+			return
+		}
+		if err := database.DBClient.First(&item, req.ItemID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+			return
+		}
+	}
+
 	// 売り切れチェック
-	if item.Status == "SOLD" {
+	if item.Status == lifecycle.Sold {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "This item is already sold out"})
 		return
 	}
+	if item.Status == lifecycle.Reserved {
+		c.JSON(http.StatusConflict, gin.H{"error": "他のユーザーが購入手続き中です", "code": "ITEM_RESERVED", "reserved_until": item.ReservedUntil})
+		return
+	}
+	// 一時停止中・アーカイブ済み・下書きの商品は購入できない
+	if item.Status != lifecycle.OnSale {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This item is not on sale"})
+		return
+	}
+	if req.Quantity > item.Stock {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("在庫が不足しています (残り%d点)", item.Stock), "stock": item.Stock})
+		return
+	}
 
-	// Stripeの設定
-	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
+	// 💡 在庫が複数ある商品は購入者ごとに数量だけ確保し、販売中のまま残りの在庫を他の購入者も購入できるようにする
+	reservedUntil := now.Add(reservationTTL())
+	if item.Stock > 1 {
+		startStockHoldCheckout(c, item, models.StockHold{
+			ItemID:        item.ID,
+			BuyerID:       buyerID,
+			Quantity:      req.Quantity,
+			OfferID:       offerID,
+			AddressID:     address.ID,
+			ReservedUntil: reservedUntil,
+		}, unitPrice)
+		return
+	}
+
+	// 💡 在庫が1点の商品は決済前に商品を確保する。同時に手続きを始めた他の購入者はここで 409 になり、二重に請求されない
+	if err := lifecycle.MoveWith(database.DBClient, &item, lifecycle.Reserved, lifecycle.ActorBuyer, map[string]interface{}{
+		"reserved_by_id":      buyerID,
+		"reserved_until":      reservedUntil,
+		"payment_intent_id":   "",
+		"reserved_quantity":   req.Quantity,
+		"reserved_offer_id":   offerID,
+		"reserved_address_id": address.ID,
+	}); err != nil {
+		if errors.Is(err, lifecycle.ErrConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": "他のユーザーが購入手続き中です", "code": "ITEM_RESERVED"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reserve item"})
+		return
+	}
+	item.ReservedByID = &buyerID
+	item.ReservedUntil = &reservedUntil
+	item.ReservedQuantity = req.Quantity
+	item.ReservedOfferID = offerID
+	item.ReservedAddressID = &address.ID
+
+	pi, err := newItemPaymentIntent(item, buyerID, req.Quantity, unitPrice, offerID)
+	if err != nil {
+		// 決済を開始できなかったので確保した商品を戻す
+		if releaseErr := releaseReservation(item, lifecycle.ActorSystem); releaseErr != nil {
+			fmt.Printf("Release Reservation Error: %v\n", releaseErr)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment intent"})
+		return
+	}
+
+	// 予約と決済インテントを結びつける。結びつけられない場合は購入を確定できないため、決済インテントを取り消す
+	result := database.DBClient.Model(&models.Item{}).
+		Where("id = ? AND status = ? AND reserved_by_id = ? AND payment_intent_id = ''", item.ID, lifecycle.Reserved, buyerID).
+		Update("payment_intent_id", pi.ID)
+	if result.Error != nil || result.RowsAffected == 0 {
+		if result.Error != nil {
+			fmt.Printf("Reservation Intent Error: %v\n", result.Error)
+		}
+		if _, err := paymentintent.Cancel(pi.ID, nil); err != nil {
+			fmt.Printf("Cancel Payment Intent Error: %v\n", err)
+		}
+		if result.Error != nil {
+			if releaseErr := releaseReservation(item, lifecycle.ActorSystem); releaseErr != nil {
+				fmt.Printf("Release Reservation Error: %v\n", releaseErr)
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment intent"})
+			return
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": "購入手続きが期限切れです。もう一度お試しください", "code": "RESERVATION_EXPIRED"})
+		return
+	}
+
+	// クライアントシークレットを返す
+	c.JSON(http.StatusOK, gin.H{
+		"clientSecret":  pi.ClientSecret,
+		"reservedUntil": reservedUntil,
+	})
+}
 
-	// 支払いインテント作成 (JPYで決済)
+// newItemPaymentIntent 商品の購入手続きの支払いインテントを作成する (JPYで決済)
+func newItemPaymentIntent(item models.Item, buyerID uint64, quantity, unitPrice int, offerID *uint64) (*stripe.PaymentIntent, error) {
 	params := &stripe.PaymentIntentParams{
-		Amount:   stripe.Int64(int64(item.Price)),
+		Amount:   stripe.Int64(int64(unitPrice) * int64(quantity)),
 		Currency: stripe.String(string(stripe.CurrencyJPY)),
 		AutomaticPaymentMethods: &stripe.PaymentIntentAutomaticPaymentMethodsParams{
 			Enabled: stripe.Bool(true),
@@ -51,29 +260,30 @@ func CreatePaymentIntentHandler(c *gin.Context) {
 
 	// メタデータに商品IDを入れておく（管理画面で見やすいように）
 	params.AddMetadata("item_id", strconv.FormatUint(item.ID, 10))
-
-	pi, err := paymentintent.New(params)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment intent"})
-		return
+	params.AddMetadata("buyer_id", strconv.FormatUint(buyerID, 10))
+	params.AddMetadata("quantity", strconv.Itoa(quantity))
+	if offerID != nil {
+		params.AddMetadata("offer_id", strconv.FormatUint(*offerID, 10))
 	}
 
-	// クライアントシークレットを返す
-	c.JSON(http.StatusOK, gin.H{
-		"clientSecret": pi.ClientSecret,
-	})
+	return paymentintent.New(params)
 }
 
 func CompletePurchaseAndCreateTransactionHandler(c *gin.Context) {
-	// クライアント（フロントエンド）から、購入者IDと商品IDを受け取る
+	// クライアント（フロントエンド）から商品IDを受け取る。購入者はログインユーザー本人
 	var req struct {
-		ItemID  uint64 `json:"item_id" binding:"required"`
-		BuyerID uint64 `json:"buyer_id" binding:"required"`
+		ItemID    uint64 `json:"item_id" binding:"required"`
+		BuyerID   uint64 `json:"buyer_id"`   // 省略可。ログインユーザー以外は指定不可
+		AddressID uint64 `json:"address_id"` // 省略可。購入手続きの開始時に選んだ配送先と異なる場合は確定できない
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: BuyerID and ItemID are required"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: ItemID is required"})
+		return
+	}
+	if rejectForeignActor(c, req.BuyerID) {
 		return
 	}
+	buyerID := middleware.CurrentUserID(c)
 
 	db := database.DBClient
 	var item models.Item
@@ -84,25 +294,139 @@ func CompletePurchaseAndCreateTransactionHandler(c *gin.Context) {
 		return
 	}
 
+	// 自分の出品物は購入できない
+	if item.SellerID == buyerID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "自分の商品は購入できません"})
+		return
+	}
+	if isBlockedBetween(item.SellerID, buyerID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "この商品は購入できません"})
+		return
+	}
+
+	// 在庫が複数ある商品は、購入者ごとの確保から確定する
+	if hold, ok := findStockHold(item.ID, buyerID); ok {
+		completeStockHoldPurchase(c, item, hold, req.AddressID)
+		return
+	}
+
+	// 購入を確定できるのは、購入手続き (予約) を行った本人のみ
+	if !isReservedBy(item, buyerID) {
+		if item.Status == lifecycle.Reserved {
+			c.JSON(http.StatusConflict, gin.H{"error": "他のユーザーが購入手続き中です", "code": "ITEM_RESERVED"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "商品が既に売り切れているか、購入手続きが期限切れです"})
+		return
+	}
+	// まとめ買いの手続き中の商品は注文の確定で購入する
+	if isOrderPaymentIntent(item.PaymentIntentID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "まとめ買いの手続き中の商品です。注文から購入を確定してください", "code": "ORDER_CHECKOUT"})
+		return
+	}
 	tx := db.Begin() // トランザクション開始
 
-	// 1. 商品を SOLD に更新 (ON_SALE のものだけを対象にして二重購入防止)
-	result := tx.Model(&models.Item{}).
-		Where("id = ? AND status = ?", req.ItemID, "ON_SALE").
-		Update("status", "SOLD")
+	// 在庫を確認してから減らすまでに取引のキャンセルで在庫が戻らないよう、商品の行をロックして読み直す
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&item, item.ID).Error; err != nil || !isReservedBy(item, buyerID) {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "商品が既に売り切れているか、購入手続きが期限切れです"})
+		return
+	}
+	// 💡 配送先は決済インテントを作成したときに選んだ住所を使う
+	if req.AddressID != 0 && item.ReservedAddressID != nil && *item.ReservedAddressID != req.AddressID {
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{"error": "配送先は購入手続きの開始時に選んだ住所から変更できません", "code": "ADDRESS_MISMATCH"})
+		return
+	}
+	addressID := req.AddressID
+	if item.ReservedAddressID != nil {
+		addressID = *item.ReservedAddressID
+	}
+	address, err := resolveShippingAddress(buyerID, addressID)
+	if err != nil {
+		tx.Rollback()
+		respondShippingAddressError(c, err)
+		return
+	}
+
+	paymentIntentID := item.PaymentIntentID
+	offerID := item.ReservedOfferID
 
-	if result.RowsAffected == 0 {
+	// 💡 予約に結びついた決済インテントの支払いが完了している場合のみ確定する
+	if paymentIntentID == "" {
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{"error": "支払いが開始されていません"})
+		return
+	}
+	configureStripe()
+	pi, err := paymentintent.Get(paymentIntentID, nil)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payment intent"})
+		return
+	}
+	if pi.Status != stripe.PaymentIntentStatusSucceeded {
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{"error": "支払いが完了していません", "payment_status": pi.Status})
+		return
+	}
+	quantity := item.ReservedQuantity
+	if quantity < 1 {
+		quantity = 1
+	}
+
+	// 承諾された値下げ交渉の価格で手続きした場合は、決済インテントと同じ単価を記録する
+	unitPrice := item.Price
+	if offerID != nil {
+		var offer models.Offer
+		if err := tx.First(&offer, *offerID).Error; err == nil {
+			unitPrice = offerUnitPrice(item, offer)
+		}
+	}
+
+	// 在庫がなくなる場合は SOLD、残る場合は販売中に戻す
+	next := lifecycle.OnSale
+	if item.Stock-quantity <= 0 {
+		next = lifecycle.Sold
+	}
+
+	// 1. 在庫を減らして状態を更新 (予約者と在庫が変わっていない場合のみ更新して二重購入防止)
+	guard := tx.Where("reserved_by_id = ? AND stock >= ?", buyerID, quantity)
+	if err := lifecycle.MoveWith(guard, &item, next, lifecycle.ActorBuyer, map[string]interface{}{
+		"stock":               gorm.Expr("stock - ?", quantity),
+		"reserved_by_id":      nil,
+		"reserved_until":      nil,
+		"payment_intent_id":   "",
+		"reserved_quantity":   0,
+		"reserved_offer_id":   nil,
+		"reserved_address_id": nil,
+	}); err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusBadRequest, gin.H{"error": "商品が既に売り切れているか、存在しません"})
 		return
 	}
 
+	// 購入時点の商品情報の版 (版がない古い商品はここで最初の版を作る)
+	revision, err := recordItemRevision(tx, item.ID, item.SellerID)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "取引の作成に失敗しました"})
+		return
+	}
+
 	// 2. 取引(Transaction)レコードを作成
 	newTx := models.Transaction{
-		ItemID:   req.ItemID,
-		BuyerID:  req.BuyerID,
-		SellerID: item.SellerID,
-		Status:   "PURCHASED", // 取引開始
+		ItemID:          req.ItemID,
+		BuyerID:         buyerID,
+		SellerID:        item.SellerID,
+		PriceSnapshot:   unitPrice,
+		Quantity:        quantity,
+		OfferID:         offerID,
+		StripePaymentID: paymentIntentID,
+		ItemRevisionID:  &revision.ID,
+		Status:          "PURCHASED", // 取引開始
+		// 購入時点の配送先を保存 (以後の住所録の変更は反映しない)
+		ShippingAddress: address.Snapshot(),
 	}
 	if err := tx.Create(&newTx).Error; err != nil {
 		tx.Rollback()
@@ -113,18 +437,44 @@ func CompletePurchaseAndCreateTransactionHandler(c *gin.Context) {
 	tx.Commit()
 
 	// 出品者への通知
+	notifyPurchase(item, quantity, newTx.ID)
+
+	// 5. 成功レスポンスを返す
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Purchase completed and transaction created successfully",
+		"transaction_id": newTx.ID,
+	})
+}
+
+// notifyPurchase 購入が確定したことを出品者に通知する
+func notifyPurchase(item models.Item, quantity int, transactionID uint64) {
+	content := fmt.Sprintf("祝！「%s」が購入されました。発送準備をお願いします", item.Title)
+	if quantity > 1 {
+		content = fmt.Sprintf("祝！「%s」が%d点購入されました。発送準備をお願いします", item.Title, quantity)
+	}
 	noti := models.Notification{
 		UserID:    item.SellerID,
 		Type:      "SOLD",
-		Content:   fmt.Sprintf("祝！「%s」が購入されました。発送準備をお願いします", item.Title),
-		RelatedID: newTx.ID,
+		Content:   content,
+		RelatedID: transactionID,
 	}
 	database.DBClient.Create(&noti)
 	BroadcastNotification(item.SellerID, noti)
+}
 
-	// 5. 成功レスポンスを返す
-	c.JSON(http.StatusOK, gin.H{
-		"message":        "Purchase completed and transaction created successfully",
-		"transaction_id": newTx.ID,
-	})
+// sameOffer 予約中の値下げ交渉と今回適用する値下げ交渉が同じかを返す
+func sameOffer(a, b *uint64) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// respondShippingAddressError 配送先の解決に失敗した場合のレスポンス
+func respondShippingAddressError(c *gin.Context, err error) {
+	if errors.Is(err, errNoShippingAddress) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "配送先の住所を登録してください"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load shipping address"})
 }
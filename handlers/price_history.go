@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Kousuke-irie/hackathon-backend/database"
+	"github.com/Kousuke-irie/hackathon-backend/lifecycle"
+	"github.com/Kousuke-irie/hackathon-backend/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// recordPriceChange 価格の変更履歴を保存し、値下げの場合はいいねしたユーザー宛ての通知を作成する
+// item.Price には変更後の価格を入れておく。WebSocket での送信はコミット後に呼び出し側で行う
+func recordPriceChange(tx *gorm.DB, item models.Item, oldPrice int, changedBy uint64) ([]models.Notification, error) {
+	history := models.ItemPriceHistory{
+		ItemID:    item.ID,
+		OldPrice:  oldPrice,
+		NewPrice:  item.Price,
+		ChangedBy: changedBy,
+	}
+	if err := tx.Create(&history).Error; err != nil {
+		return nil, err
+	}
+
+	// 値下げ、かつ購入できる状態の場合のみ通知する
+	if item.Price >= oldPrice || item.Status != lifecycle.OnSale {
+		return nil, nil
+	}
+
+	// 出品者をミュート・ブロックしているユーザーには通知しない
+	var userIDs []uint64
+	if err := tx.Model(&models.Like{}).
+		Where("item_id = ? AND reaction = ? AND user_id <> ?", item.ID, "LIKE", item.SellerID).
+		Where("user_id NOT IN (SELECT user_id FROM user_blocks WHERE target_id = ?)", item.SellerID).
+		Distinct().Pluck("user_id", &userIDs).Error; err != nil {
+		return nil, err
+	}
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+
+	notifications := make([]models.Notification, len(userIDs))
+	for i, userID := range userIDs {
+		notifications[i] = models.Notification{
+			UserID:    userID,
+			Type:      "PRICE_DROP",
+			Content:   fmt.Sprintf("いいねした「%s」が%d円から%d円に値下げされました", item.Title, oldPrice, item.Price),
+			RelatedID: item.ID,
+		}
+	}
+	if err := tx.Create(&notifications).Error; err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+// GetPriceHistoryHandler 商品の価格変更履歴を取得 (GET /items/:id/price-history)
+func GetPriceHistoryHandler(c *gin.Context) {
+	var item models.Item
+	if err := database.DBClient.First(&item, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+
+	var history []models.ItemPriceHistory
+	if err := database.DBClient.Where("item_id = ?", item.ID).
+		Order("created_at ASC, id ASC").
+		Find(&history).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch price history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"current_price": item.Price,
+		"history":       history,
+	})
+}
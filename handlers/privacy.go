@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Kousuke-irie/hackathon-backend/database"
+	"github.com/Kousuke-irie/hackathon-backend/middleware"
+	"github.com/Kousuke-irie/hackathon-backend/models"
+	"github.com/gin-gonic/gin"
+)
+
+// canView 公開範囲 visibility の項目を、閲覧者 viewerID が見られるかを返す (viewerID が 0 なら未ログイン)
+func canView(visibility string, ownerID, viewerID uint64) bool {
+	if viewerID != 0 && viewerID == ownerID {
+		return true
+	}
+	switch visibility {
+	case models.VisibilityPublic:
+		return true
+	case models.VisibilityFollowers:
+		if viewerID == 0 {
+			return false
+		}
+		var count int64
+		database.DBClient.Model(&models.Follow{}).
+			Where("follower_id = ? AND following_id = ?", viewerID, ownerID).
+			Count(&count)
+		return count > 0
+	}
+	return false
+}
+
+// loadVisibleProfileOwner パスの :id のユーザーを取得し、指定項目の公開範囲を満たすか確認する
+// 失敗時はレスポンスを書き込んで false を返す
+func loadVisibleProfileOwner(c *gin.Context, visibility func(models.PrivacySettings) string) (*models.User, bool) {
+	var user models.User
+	if err := database.DBClient.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	if !canView(visibility(user.Privacy), uint64(user.ID), middleware.CurrentUserID(c)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "このユーザーは情報を非公開にしています"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// GetPrivacySettingsHandler 自分の公開範囲設定を取得
+func GetPrivacySettingsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"privacy": middleware.CurrentUser(c).Privacy})
+}
+
+// UpdatePrivacySettingsHandler 自分の公開範囲設定を更新 (指定した項目のみ)
+func UpdatePrivacySettingsHandler(c *gin.Context) {
+	var req struct {
+		FollowList *string `json:"follow_list"`
+		Likes      *string `json:"likes"`
+		Reviews    *string `json:"reviews"`
+		Birthdate  *string `json:"birthdate"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	privacy := middleware.CurrentUser(c).Privacy
+	for _, f := range []struct {
+		Value *string
+		Dest  *string
+	}{
+		{req.FollowList, &privacy.FollowList},
+		{req.Likes, &privacy.Likes},
+		{req.Reviews, &privacy.Reviews},
+		{req.Birthdate, &privacy.Birthdate},
+	} {
+		if f.Value == nil {
+			continue
+		}
+		switch *f.Value {
+		case models.VisibilityPublic, models.VisibilityFollowers, models.VisibilityPrivate:
+			*f.Dest = *f.Value
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Visibility must be PUBLIC, FOLLOWERS or PRIVATE"})
+			return
+		}
+	}
+
+	if err := database.DBClient.Model(&models.User{}).
+		Where("id = ?", middleware.CurrentUserID(c)).
+		Updates(map[string]interface{}{
+			"privacy_follow_list": privacy.FollowList,
+			"privacy_likes":       privacy.Likes,
+			"privacy_reviews":     privacy.Reviews,
+			"privacy_birthdate":   privacy.Birthdate,
+		}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update privacy settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Privacy settings updated", "privacy": privacy})
+}
+
+// GetUserLikesHandler 特定ユーザーがいいねした商品一覧を取得 (公開範囲内の閲覧者のみ)
+func GetUserLikesHandler(c *gin.Context) {
+	user, ok := loadVisibleProfileOwner(c, func(p models.PrivacySettings) string { return p.Likes })
+	if !ok {
+		return
+	}
+
+	var items []models.Item
+	if err := database.DBClient.
+		Joins("JOIN likes ON likes.item_id = items.id").
+		Where("likes.user_id = ? AND likes.reaction = ?", user.ID, "LIKE").
+		Where("items.status = ?", "ON_SALE").
+		Order("likes.created_at DESC").
+		Limit(40).
+		Find(&items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch liked items"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/Kousuke-irie/hackathon-backend/database"
+	"github.com/Kousuke-irie/hackathon-backend/lifecycle"
+	"github.com/Kousuke-irie/hackathon-backend/middleware"
+	"github.com/Kousuke-irie/hackathon-backend/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stripe/stripe-go/v79"
+	"github.com/stripe/stripe-go/v79/paymentintent"
+)
+
+// defaultReservationTTL 購入手続きの開始から商品を確保しておく時間
+const defaultReservationTTL = 15 * time.Minute
+
+// errPaymentAlreadySucceeded 決済済みのため予約を解放できない (購入確定の処理を待つ)
+var errPaymentAlreadySucceeded = errors.New("payment intent has already succeeded")
+
+// reservationTTL CHECKOUT_RESERVATION_TTL (例: "10m") で上書きできる
+func reservationTTL() time.Duration {
+	if v := os.Getenv("CHECKOUT_RESERVATION_TTL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return defaultReservationTTL
+}
+
+// configureStripe Stripe の API キーを設定する
+func configureStripe() {
+	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
+}
+
+// isReservedBy 商品が userID によって購入手続き中かを返す
+func isReservedBy(item models.Item, userID uint64) bool {
+	return item.Status == lifecycle.Reserved && item.ReservedByID != nil && *item.ReservedByID == userID
+}
+
+// reservationExpired 予約の期限が過ぎているかを返す
+func reservationExpired(item models.Item, now time.Time) bool {
+	return item.ReservedUntil == nil || !item.ReservedUntil.After(now)
+}
+
+// releaseReservation 予約を解放して ON_SALE に戻し、決済インテントをキャンセルする
+// 決済が完了済みの場合は解放せず errPaymentAlreadySucceeded を返す
+func releaseReservation(item models.Item, actor lifecycle.Actor) error {
+	if err := cancelReservedIntent(item.PaymentIntentID); err != nil {
+		return err
+	}
+
+	// 確認後に別の予約に置き換わっていた場合は解放しない
+	guard := database.DBClient.Where("payment_intent_id = ?", item.PaymentIntentID)
+	if err := lifecycle.MoveWith(guard, &item, lifecycle.OnSale, actor, map[string]interface{}{
+		"reserved_by_id":      nil,
+		"reserved_until":      nil,
+		"payment_intent_id":   "",
+		"reserved_quantity":   0,
+		"reserved_offer_id":   nil,
+		"reserved_address_id": nil,
+	}); err != nil {
+		return err
+	}
+
+	// まとめ買いの手続き中だった場合は注文を取り消し、同じ決済の他の商品も解放する
+	if item.PaymentIntentID != "" {
+		cancelPendingOrder(item.PaymentIntentID)
+	}
+	return nil
+}
+
+// cancelReservedIntent 購入手続きの決済インテントをキャンセルする (未作成・キャンセル済みの場合は何もしない)
+// 決済が完了済み・処理中の場合は errPaymentAlreadySucceeded を返す
+func cancelReservedIntent(paymentIntentID string) error {
+	if paymentIntentID == "" {
+		return nil
+	}
+	configureStripe()
+	pi, err := paymentintent.Get(paymentIntentID, nil)
+	if err != nil {
+		return fmt.Errorf("failed to fetch payment intent: %w", err)
+	}
+	switch pi.Status {
+	case stripe.PaymentIntentStatusSucceeded, stripe.PaymentIntentStatusProcessing:
+		return errPaymentAlreadySucceeded
+	case stripe.PaymentIntentStatusCanceled:
+	default:
+		if _, err := paymentintent.Cancel(paymentIntentID, nil); err != nil {
+			return fmt.Errorf("failed to cancel payment intent: %w", err)
+		}
+	}
+	return nil
+}
+
+// CancelCheckoutHandler 自分の購入手続きを中止して商品を解放する (POST /payment/cancel)
+func CancelCheckoutHandler(c *gin.Context) {
+	var req struct {
+		ItemID uint64 `json:"item_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "item_id is required"})
+		return
+	}
+
+	var item models.Item
+	if err := database.DBClient.First(&item, req.ItemID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+	buyerID := middleware.CurrentUserID(c)
+
+	var err error
+	if hold, ok := findStockHold(item.ID, buyerID); ok {
+		// 在庫が複数ある商品は確保した数量を在庫に戻す
+		err = releaseStockHold(hold)
+	} else if isReservedBy(item, buyerID) {
+		err = releaseReservation(item, lifecycle.ActorBuyer)
+	} else {
+		c.JSON(http.StatusConflict, gin.H{"error": "この商品の購入手続き中ではありません"})
+		return
+	}
+
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, gin.H{"message": "Checkout canceled"})
+	case errors.Is(err, errPaymentAlreadySucceeded):
+		c.JSON(http.StatusConflict, gin.H{"error": "決済が完了しているため中止できません"})
+	case errors.Is(err, lifecycle.ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": "この商品の購入手続き中ではありません"})
+	default:
+		fmt.Printf("Cancel Checkout Error: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel checkout"})
+	}
+}
+
+// StartReservationSweeper 期限切れの購入手続きを interval ごとに解放するバックグラウンド処理を開始する
+func StartReservationSweeper(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			sweepExpiredReservations()
+			sweepExpiredStockHolds()
+		}
+	}()
+}
+
+// sweepExpiredReservations 期限切れの予約を解放し、決済インテントをキャンセルする
+func sweepExpiredReservations() {
+	var items []models.Item
+	if err := database.DBClient.
+		Where("status = ? AND reserved_until < ?", lifecycle.Reserved, time.Now()).
+		Limit(100).
+		Find(&items).Error; err != nil {
+		log.Printf("Reservation sweeper: failed to fetch reservations: %v", err)
+		return
+	}
+
+	for _, item := range items {
+		err := releaseReservation(item, lifecycle.ActorSystem)
+		switch {
+		case err == nil:
+			log.Printf("Reservation sweeper: released item %d", item.ID)
+		case errors.Is(err, errPaymentAlreadySucceeded):
+			// 決済済みで購入確定が届いていない。返金・確定の判断が必要なため残す
+			log.Printf("WARNING: Reservation sweeper: item %d has a paid intent %s but no transaction", item.ID, item.PaymentIntentID)
+		case errors.Is(err, lifecycle.ErrConflict):
+			// 他の処理が先に状態を変更した
+		default:
+			log.Printf("Reservation sweeper: failed to release item %d: %v", item.ID, err)
+		}
+	}
+}
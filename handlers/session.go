@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Kousuke-irie/hackathon-backend/database"
+	"github.com/Kousuke-irie/hackathon-backend/middleware"
+	"github.com/Kousuke-irie/hackathon-backend/models"
+	"github.com/Kousuke-irie/hackathon-backend/session"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// issueSession 新しいセッションを作成し、アクセストークンとリフレッシュトークンを返す
+func issueSession(c *gin.Context, userID uint64) (gin.H, error) {
+	refreshToken, refreshHash, err := session.NewRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	sess := models.Session{
+		UserID:           userID,
+		RefreshTokenHash: refreshHash,
+		UserAgent:        truncate(c.Request.UserAgent(), 255),
+		ExpiresAt:        now.Add(session.RefreshTokenTTL),
+		LastUsedAt:       now,
+	}
+	if err := database.DBClient.Create(&sess).Error; err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return tokenResponse(userID, sess.ID, refreshToken)
+}
+
+func tokenResponse(userID, sessionID uint64, refreshToken string) (gin.H, error) {
+	accessToken, err := session.IssueAccessToken(userID, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue access token: %w", err)
+	}
+	return gin.H{
+		"access_token":  accessToken,
+		"refresh_token": refreshToken,
+		"token_type":    "Bearer",
+		"expires_in":    int(session.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// RefreshSessionHandler リフレッシュトークンをローテーションし、新しいトークンの組を返す
+// ローテーション済みの古いトークンが再提示された場合は盗用とみなしてセッションを失効させる
+func RefreshSessionHandler(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "refresh_token is required"})
+		return
+	}
+
+	presentedHash := session.HashRefreshToken(req.RefreshToken)
+	newToken, newHash, err := session.NewRefreshToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+
+	var sess models.Session
+	err = database.DBClient.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("refresh_token_hash = ? AND revoked_at IS NULL AND expires_at > ?", presentedHash, now).
+			First(&sess).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&sess).Updates(map[string]interface{}{
+			"refresh_token_hash":          newHash,
+			"previous_refresh_token_hash": presentedHash,
+			"expires_at":                  now.Add(session.RefreshTokenTTL),
+			"last_used_at":                now,
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// ローテーション済みの旧トークンが使われた場合は、そのセッションごと失効させる
+		result := database.DBClient.Model(&models.Session{}).
+			Where("previous_refresh_token_hash = ? AND revoked_at IS NULL", presentedHash).
+			Update("revoked_at", time.Now())
+		if result.RowsAffected > 0 {
+			log.Printf("WARNING: refresh token reuse detected; session revoked")
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+
+	tokens, err := tokenResponse(sess.UserID, sess.ID, newToken)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// LogoutHandler 現在のセッションを失効させる
+func LogoutHandler(c *gin.Context) {
+	if _, err := revokeSessions(middleware.CurrentUserID(c), middleware.CurrentSessionID(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+// LogoutAllHandler 自分の全端末のセッションを失効させる
+func LogoutAllHandler(c *gin.Context) {
+	if _, err := revokeSessions(middleware.CurrentUserID(c), 0); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out from all devices"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out from all devices"})
+}
+
+// GetSessionsHandler 自分の有効なセッション (ログイン中の端末) 一覧を取得
+func GetSessionsHandler(c *gin.Context) {
+	var sessions []models.Session
+	if err := database.DBClient.
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", middleware.CurrentUserID(c), time.Now()).
+		Order("last_used_at DESC").
+		Find(&sessions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions, "current_session_id": middleware.CurrentSessionID(c)})
+}
+
+// RevokeSessionHandler 指定した端末のセッションを失効させる (紛失・盗難時用)
+func RevokeSessionHandler(c *gin.Context) {
+	sessionID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || sessionID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	revoked, err := revokeSessions(middleware.CurrentUserID(c), sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+	// 他のユーザーのセッション・存在しないセッション・失効済みのセッション
+	if revoked == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// revokeSessions ユーザーのセッションを失効させ、失効させた数を返す。sessionID が 0 の場合は全セッションが対象
+func revokeSessions(userID, sessionID uint64) (int64, error) {
+	query := database.DBClient.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+	if sessionID != 0 {
+		query = query.Where("id = ?", sessionID)
+	}
+	result := query.Update("revoked_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[:max]
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Kousuke-irie/hackathon-backend/database"
+	"github.com/Kousuke-irie/hackathon-backend/middleware"
+	"github.com/Kousuke-irie/hackathon-backend/models"
+	"github.com/gin-gonic/gin"
+)
+
+// ShippingRuleRequest まとめ買いの送料ルールの更新内容
+type ShippingRuleRequest struct {
+	BaseFee               int `json:"base_fee"`
+	PerItemFee            int `json:"per_item_fee"`
+	FreeShippingThreshold int `json:"free_shipping_threshold"`
+	MaxItems              int `json:"max_items"`
+}
+
+// loadShippingRule 出品者の送料ルールを返す。未設定の場合は送料を加算しないルールを返す
+func loadShippingRule(sellerID uint64) (models.ShippingRule, error) {
+	rule := models.ShippingRule{SellerID: sellerID}
+	err := database.DBClient.Where("seller_id = ?", sellerID).Limit(1).Find(&rule).Error
+	return rule, err
+}
+
+// GetMyShippingRuleHandler 自分のまとめ買いの送料ルールを取得 (GET /users/me/shipping-rule)
+func GetMyShippingRuleHandler(c *gin.Context) {
+	rule, err := loadShippingRule(middleware.CurrentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shipping rule"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"shipping_rule": rule})
+}
+
+// GetUserShippingRuleHandler 出品者のまとめ買いの送料ルールを取得 (GET /users/:id/shipping-rule)
+func GetUserShippingRuleHandler(c *gin.Context) {
+	sellerID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	rule, err := loadShippingRule(sellerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shipping rule"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"shipping_rule": rule})
+}
+
+// UpdateShippingRuleHandler 自分のまとめ買いの送料ルールを設定 (PUT /users/me/shipping-rule)
+func UpdateShippingRuleHandler(c *gin.Context) {
+	var req ShippingRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+	if req.BaseFee < 0 || req.PerItemFee < 0 || req.FreeShippingThreshold < 0 || req.MaxItems < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Fees and limits must not be negative"})
+		return
+	}
+	if req.MaxItems > maxOrderItems {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("max_items must be at most %d", maxOrderItems)})
+		return
+	}
+
+	rule, err := loadShippingRule(middleware.CurrentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shipping rule"})
+		return
+	}
+	rule.BaseFee = req.BaseFee
+	rule.PerItemFee = req.PerItemFee
+	rule.FreeShippingThreshold = req.FreeShippingThreshold
+	rule.MaxItems = req.MaxItems
+	if err := database.DBClient.Save(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save shipping rule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Shipping rule updated", "shipping_rule": rule})
+}
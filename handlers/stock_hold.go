@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Kousuke-irie/hackathon-backend/database"
+	"github.com/Kousuke-irie/hackathon-backend/lifecycle"
+	"github.com/Kousuke-irie/hackathon-backend/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stripe/stripe-go/v79"
+	"github.com/stripe/stripe-go/v79/paymentintent"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// findStockHold 購入者が商品の数量を確保しているかを返す
+func findStockHold(itemID, buyerID uint64) (models.StockHold, bool) {
+	var hold models.StockHold
+	if err := database.DBClient.Where("item_id = ? AND buyer_id = ?", itemID, buyerID).First(&hold).Error; err != nil {
+		return hold, false
+	}
+	return hold, true
+}
+
+// reserveStock 在庫から数量を引いて購入者ごとの確保を作成する
+// 在庫が足りない場合は lifecycle.ErrConflict、同じ購入者の確保が既にある場合は gorm.ErrDuplicatedKey を返す
+func reserveStock(hold *models.StockHold) error {
+	return database.DBClient.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Item{}).
+			Where("id = ? AND status = ? AND stock >= ?", hold.ItemID, lifecycle.OnSale, hold.Quantity).
+			Update("stock", gorm.Expr("stock - ?", hold.Quantity))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return lifecycle.ErrConflict
+		}
+		return tx.Create(hold).Error
+	})
+}
+
+// releaseStockHold 確保した数量を在庫に戻し、決済インテントをキャンセルする
+// 決済が完了済みの場合は解放せず errPaymentAlreadySucceeded を返す
+func releaseStockHold(hold models.StockHold) error {
+	if err := cancelReservedIntent(hold.PaymentIntentID); err != nil {
+		return err
+	}
+
+	return database.DBClient.Transaction(func(tx *gorm.DB) error {
+		// 確認後に購入が確定した・別の手続きに置き換わった場合は戻さない
+		result := tx.Where("id = ? AND payment_intent_id = ?", hold.ID, hold.PaymentIntentID).Delete(&models.StockHold{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return lifecycle.ErrConflict
+		}
+		if err := tx.Model(&models.Item{}).Where("id = ?", hold.ItemID).
+			Update("stock", gorm.Expr("stock + ?", hold.Quantity)).Error; err != nil {
+			return err
+		}
+
+		// 他の購入者の確定で売り切れになっていた場合は販売中に戻す
+		var item models.Item
+		if err := tx.First(&item, hold.ItemID).Error; err != nil || item.Status != lifecycle.Sold {
+			return nil
+		}
+		if err := lifecycle.Move(tx, &item, lifecycle.OnSale, lifecycle.ActorSystem); err != nil && !errors.Is(err, lifecycle.ErrConflict) {
+			return err
+		}
+		return nil
+	})
+}
+
+// startStockHoldCheckout 在庫が複数ある商品の購入手続きを開始する
+// 数量分だけ在庫を確保して決済インテントを作成し、商品は ON_SALE のまま残す
+func startStockHoldCheckout(c *gin.Context, item models.Item, hold models.StockHold, unitPrice int) {
+	if err := reserveStock(&hold); err != nil {
+		switch {
+		case errors.Is(err, lifecycle.ErrConflict):
+			c.JSON(http.StatusConflict, gin.H{"error": "在庫が不足しています。もう一度お試しください", "code": "OUT_OF_STOCK"})
+		case errors.Is(err, gorm.ErrDuplicatedKey):
+			c.JSON(http.StatusConflict, gin.H{"error": "この商品の購入手続き中です", "code": "CHECKOUT_IN_PROGRESS"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reserve item"})
+		}
+		return
+	}
+
+	pi, err := newItemPaymentIntent(item, hold.BuyerID, hold.Quantity, unitPrice, hold.OfferID)
+	if err != nil {
+		// 決済を開始できなかったので確保した在庫を戻す
+		if releaseErr := releaseStockHold(hold); releaseErr != nil {
+			fmt.Printf("Release Stock Hold Error: %v\n", releaseErr)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment intent"})
+		return
+	}
+
+	// 確保と決済インテントを結びつける。結びつけられない場合は購入を確定できないため、決済インテントを取り消す
+	result := database.DBClient.Model(&models.StockHold{}).
+		Where("id = ? AND payment_intent_id = ''", hold.ID).
+		Update("payment_intent_id", pi.ID)
+	if result.Error != nil || result.RowsAffected == 0 {
+		if result.Error != nil {
+			fmt.Printf("Stock Hold Intent Error: %v\n", result.Error)
+		}
+		if _, err := paymentintent.Cancel(pi.ID, nil); err != nil {
+			fmt.Printf("Cancel Payment Intent Error: %v\n", err)
+		}
+		if result.Error != nil {
+			if releaseErr := releaseStockHold(hold); releaseErr != nil {
+				fmt.Printf("Release Stock Hold Error: %v\n", releaseErr)
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment intent"})
+			return
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": "購入手続きが期限切れです。もう一度お試しください", "code": "RESERVATION_EXPIRED"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"clientSecret":  pi.ClientSecret,
+		"reservedUntil": hold.ReservedUntil,
+	})
+}
+
+// completeStockHoldPurchase 在庫が複数ある商品の購入を、購入者の確保 (StockHold) から確定する
+// 在庫は確保時に引いてあるため、在庫がなくなり他の確保も残っていない場合のみ SOLD にする
+func completeStockHoldPurchase(c *gin.Context, item models.Item, hold models.StockHold, addressID uint64) {
+	// 💡 配送先は決済インテントを作成したときに選んだ住所を使う
+	if addressID != 0 && addressID != hold.AddressID {
+		c.JSON(http.StatusConflict, gin.H{"error": "配送先は購入手続きの開始時に選んだ住所から変更できません", "code": "ADDRESS_MISMATCH"})
+		return
+	}
+	address, err := resolveShippingAddress(hold.BuyerID, hold.AddressID)
+	if err != nil {
+		respondShippingAddressError(c, err)
+		return
+	}
+
+	if hold.PaymentIntentID == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "支払いが開始されていません"})
+		return
+	}
+	configureStripe()
+	pi, err := paymentintent.Get(hold.PaymentIntentID, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payment intent"})
+		return
+	}
+	if pi.Status != stripe.PaymentIntentStatusSucceeded {
+		c.JSON(http.StatusConflict, gin.H{"error": "支払いが完了していません", "payment_status": pi.Status})
+		return
+	}
+
+	var newTx models.Transaction
+	err = database.DBClient.Transaction(func(tx *gorm.DB) error {
+		// 他の確保の解放・確定と売り切れの判定が入れ違わないよう、商品の行をロックする
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&item, item.ID).Error; err != nil {
+			return err
+		}
+		// 確保が解放・確定済みであれば二重に確定しない
+		result := tx.Where("id = ? AND payment_intent_id = ?", hold.ID, hold.PaymentIntentID).Delete(&models.StockHold{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return lifecycle.ErrConflict
+		}
+
+		// 承諾された値下げ交渉の価格で手続きした場合は、決済インテントと同じ単価を記録する
+		unitPrice := item.Price
+		if hold.OfferID != nil {
+			var offer models.Offer
+			if err := tx.First(&offer, *hold.OfferID).Error; err == nil {
+				unitPrice = offerUnitPrice(item, offer)
+			}
+		}
+
+		revision, err := recordItemRevision(tx, item.ID, item.SellerID)
+		if err != nil {
+			return err
+		}
+		newTx = models.Transaction{
+			ItemID:          item.ID,
+			BuyerID:         hold.BuyerID,
+			SellerID:        item.SellerID,
+			PriceSnapshot:   unitPrice,
+			Quantity:        hold.Quantity,
+			OfferID:         hold.OfferID,
+			StripePaymentID: hold.PaymentIntentID,
+			ItemRevisionID:  &revision.ID,
+			Status:          "PURCHASED",
+			ShippingAddress: address.Snapshot(),
+		}
+		if err := tx.Create(&newTx).Error; err != nil {
+			return err
+		}
+
+		if item.Stock > 0 {
+			return nil
+		}
+		var remaining int64
+		if err := tx.Model(&models.StockHold{}).Where("item_id = ?", item.ID).Count(&remaining).Error; err != nil {
+			return err
+		}
+		if remaining > 0 {
+			return nil
+		}
+		// 一時停止中などで売り切れにできない場合も購入自体は確定する
+		err = lifecycle.Move(tx, &item, lifecycle.Sold, lifecycle.ActorSystem)
+		if err != nil && !errors.Is(err, lifecycle.ErrInvalidTransition) && !errors.Is(err, lifecycle.ErrConflict) {
+			return err
+		}
+		return nil
+	})
+	if errors.Is(err, lifecycle.ErrConflict) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "商品が既に売り切れているか、購入手続きが期限切れです"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "取引の作成に失敗しました"})
+		return
+	}
+
+	notifyPurchase(item, hold.Quantity, newTx.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Purchase completed and transaction created successfully",
+		"transaction_id": newTx.ID,
+	})
+}
+
+// sweepExpiredStockHolds 期限切れの確保を在庫に戻し、決済インテントをキャンセルする
+func sweepExpiredStockHolds() {
+	var holds []models.StockHold
+	if err := database.DBClient.
+		Where("reserved_until < ?", time.Now()).
+		Limit(100).
+		Find(&holds).Error; err != nil {
+		log.Printf("Reservation sweeper: failed to fetch stock holds: %v", err)
+		return
+	}
+
+	for _, hold := range holds {
+		err := releaseStockHold(hold)
+		switch {
+		case err == nil:
+			log.Printf("Reservation sweeper: released %d units of item %d", hold.Quantity, hold.ItemID)
+		case errors.Is(err, errPaymentAlreadySucceeded):
+			// 決済済みで購入確定が届いていない。返金・確定の判断が必要なため残す
+			log.Printf("WARNING: Reservation sweeper: stock hold %d has a paid intent %s but no transaction", hold.ID, hold.PaymentIntentID)
+		case errors.Is(err, lifecycle.ErrConflict):
+			// 他の処理が先に確定・解放した
+		default:
+			log.Printf("Reservation sweeper: failed to release stock hold %d: %v", hold.ID, err)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/Kousuke-irie/hackathon-backend/database"
 	"github.com/Kousuke-irie/hackathon-backend/gemini"
+	"github.com/Kousuke-irie/hackathon-backend/middleware"
 	"github.com/Kousuke-irie/hackathon-backend/models"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm/clause"
@@ -14,11 +15,7 @@ import (
 
 // GetSwipeItemsHandler まだスワイプしていない商品を取得
 func GetSwipeItemsHandler(c *gin.Context) {
-	userID := c.GetHeader("X-User-ID")
-	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "User ID header is required"})
-		return
-	}
+	userID := middleware.CurrentUserID(c)
 
 	db := database.DBClient
 
@@ -34,6 +31,7 @@ func GetSwipeItemsHandler(c *gin.Context) {
 
 	var items []models.Item
 	query := db.Where("status = ?", "ON_SALE").Where("seller_id != ?", userID)
+	query = excludeHiddenUsers(query, "seller_id", userID)
 
 	// すでにスワイプ済みの商品を除外するサブクエリ
 	subQuery := db.Table("likes").Select("item_id").Where("user_id = ?", userID)
@@ -76,7 +74,7 @@ func GetSwipeItemsHandler(c *gin.Context) {
 
 // RecordSwipeRequest スワイプ記録用のリクエストボディ
 type RecordSwipeRequest struct {
-	UserID   uint64 `json:"user_id"`
+	UserID   uint64 `json:"user_id"` // 省略可。ログインユーザー以外は指定不可
 	ItemID   uint64 `json:"item_id"`
 	Reaction string `json:"reaction"` // "LIKE" or "NOPE"
 }
@@ -89,8 +87,12 @@ func RecordSwipeHandler(c *gin.Context) {
 		return
 	}
 
+	if rejectForeignActor(c, req.UserID) {
+		return
+	}
+
 	newLike := models.Like{
-		UserID:   req.UserID,
+		UserID:   middleware.CurrentUserID(c),
 		ItemID:   req.ItemID,
 		Reaction: req.Reaction,
 	}
@@ -1,21 +1,61 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/Kousuke-irie/hackathon-backend/database"
+	"github.com/Kousuke-irie/hackathon-backend/lifecycle"
+	"github.com/Kousuke-irie/hackathon-backend/middleware"
 	"github.com/Kousuke-irie/hackathon-backend/models"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
 type PostReviewRequest struct {
-	RaterID uint64 `json:"rater_id" binding:"required"`
+	RaterID uint64 `json:"rater_id"`                  // 省略可。ログインユーザー以外は指定不可
 	Rating  int    `json:"rating" binding:"required"` // 評価点 (例: 1-5)
 	Comment string `json:"comment"`
-	Role    string `json:"role" binding:"required"` // 評価者の役割 ('BUYER' or 'SELLER')
+	Role    string `json:"role"` // 省略可。評価者の役割はサーバー側で取引から判定する
+}
+
+// transactionStatusTransitions 取引の状態の更新 (更新後の状態 → 更新前の状態と更新できる当事者)
+// キャンセルは在庫を戻すため CancelTransactionHandler でのみ行う
+var transactionStatusTransitions = map[string]struct {
+	From string
+	Role string
+}{
+	"SHIPPED":   {"PURCHASED", "SELLER"},
+	"COMPLETED": {"SHIPPED", "BUYER"},
+}
+
+// transactionRole ユーザーが取引の購入者なら BUYER、出品者なら SELLER、どちらでもなければ空文字を返す
+func transactionRole(tx models.Transaction, userID uint64) string {
+	switch userID {
+	case tx.BuyerID:
+		return "BUYER"
+	case tx.SellerID:
+		return "SELLER"
+	}
+	return ""
+}
+
+// loadParticipantTransaction 取引を取得し、ログインユーザーが当事者であることを確認する
+// 失敗時はレスポンスを書き込んで false を返す
+func loadParticipantTransaction(c *gin.Context, txID uint64) (models.Transaction, string, bool) {
+	var tx models.Transaction
+	if err := database.DBClient.First(&tx, txID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+		return tx, "", false
+	}
+	role := transactionRole(tx, middleware.CurrentUserID(c))
+	if role == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a participant of this transaction"})
+		return tx, "", false
+	}
+	return tx, role, true
 }
 
 // UpdateTransactionStatusHandler ステータスを更新（発送、受け取りなど）
@@ -35,15 +75,49 @@ func UpdateTransactionStatusHandler(c *gin.Context) {
 		return
 	}
 
-	// 💡 権限チェック: ここでは省略しますが、出品者または購入者のみが実行できるべきです。
+	transition, known := transactionStatusTransitions[req.NewStatus]
+	if !known {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+		return
+	}
+
+	// 💡 権限チェック: 出品者または購入者のみが実行できる
+	current, role, ok := loadParticipantTransaction(c, txID)
+	if !ok {
+		return
+	}
+	// まとめ買いの取引は注文単位で更新する
+	if current.OrderID != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "まとめ買いの取引は注文から操作してください", "code": "ORDER_TRANSACTION", "order_id": *current.OrderID})
+		return
+	}
+	// 落札後の支払い待ちの取引は、支払いの確認でのみ開始する
+	if current.Status == models.TransactionPaymentPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "落札代金の支払いが完了していません"})
+		return
+	}
 
-	// ステータスを更新
-	if err := database.DBClient.Model(&models.Transaction{}).
-		Where("id = ?", txID).
-		Update("status", req.NewStatus).Error; err != nil {
+	if role != transition.Role {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have permission to update this transaction to " + req.NewStatus})
+		return
+	}
+	if current.Status != transition.From {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Transaction must be %s to become %s", transition.From, req.NewStatus)})
+		return
+	}
+
+	// ステータスを更新 (確認した状態からのみ更新)
+	result := database.DBClient.Model(&models.Transaction{}).
+		Where("id = ? AND status = ?", txID, transition.From).
+		Update("status", req.NewStatus)
+	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update status"})
 		return
 	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Transaction status was changed. Please reload and try again"})
+		return
+	}
 
 	if req.NewStatus == "SHIPPED" {
 		var tx models.Transaction
@@ -63,6 +137,7 @@ func UpdateTransactionStatusHandler(c *gin.Context) {
 }
 
 // PostReviewHandler 評価を投稿し、取引ステータスを更新
+// 発送済み (SHIPPED) の取引は購入者の評価で受け取り完了 (COMPLETED) になる。出品者は受け取り完了後に評価する
 func PostReviewHandler(c *gin.Context) {
 	txIDStr := c.Param("tx_id")
 	txID, err := strconv.ParseUint(txIDStr, 10, 64)
@@ -76,6 +151,29 @@ func PostReviewHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
 		return
 	}
+	if rejectForeignActor(c, req.RaterID) {
+		return
+	}
+
+	// 評価者の役割は、ログインユーザーが取引の購入者か出品者かで決まる
+	current, role, ok := loadParticipantTransaction(c, txID)
+	if !ok {
+		return
+	}
+	if req.Role != "" && req.Role != role {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Role does not match your side of the transaction"})
+		return
+	}
+	// まとめ買いの取引は注文から受け取りを完了する (完了後の評価のみ受け付ける)
+	if current.OrderID != nil && current.Status != "COMPLETED" {
+		c.JSON(http.StatusConflict, gin.H{"error": "まとめ買いの取引は注文から操作してください", "code": "ORDER_TRANSACTION", "order_id": *current.OrderID})
+		return
+	}
+	completes := current.Status == "SHIPPED" && role == "BUYER"
+	if !completes && current.Status != "COMPLETED" {
+		c.JSON(http.StatusConflict, gin.H{"error": "この取引はまだ評価できません"})
+		return
+	}
 
 	db := database.DBClient
 
@@ -84,32 +182,50 @@ func PostReviewHandler(c *gin.Context) {
 		// 1. レビューの作成
 		newReview := models.Review{
 			TransactionID: txID,
-			RaterID:       req.RaterID,
+			RaterID:       middleware.CurrentUserID(c),
 			Rating:        req.Rating,
 			Comment:       req.Comment,
-			Role:          req.Role,
+			Role:          role,
 		}
 		if err := dbTx.Create(&newReview).Error; err != nil {
 			return err
 		}
 
-		// 2. 取引ステータスの更新
-		if err := dbTx.Model(&models.Transaction{}).
-			Where("id = ?", txID).
-			Update("status", "COMPLETED").Error; err != nil {
-			return err
+		// 2. 取引ステータスの更新 (確認した状態からのみ更新)
+		if !completes {
+			return nil
+		}
+		result := dbTx.Model(&models.Transaction{}).
+			Where("id = ? AND status = ?", txID, "SHIPPED").
+			Update("status", "COMPLETED")
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return lifecycle.ErrConflict
 		}
-
 		return nil
 	})
 
+	if errors.Is(err, lifecycle.ErrConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Transaction status was changed. Please reload and try again"})
+		return
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		c.JSON(http.StatusConflict, gin.H{"error": "この取引は評価済みです"})
+		return
+	}
 	if err != nil {
 		fmt.Printf("Review Error: %v\n", err) // サーバーログにエラーを出力
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to post review and update status"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Review posted and transaction completed"})
+	if completes {
+		c.JSON(http.StatusOK, gin.H{"message": "Review posted and transaction completed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Review posted"})
 }
 
 // CancelTransactionHandler 取引をキャンセル
@@ -121,33 +237,70 @@ func CancelTransactionHandler(c *gin.Context) {
 		return
 	}
 
+	// 💡 権限チェック: 出品者または購入者のみがキャンセルできる
+	current, _, ok := loadParticipantTransaction(c, txID)
+	if !ok {
+		return
+	}
+	// まとめ買いの取引は注文単位でキャンセルする
+	if current.OrderID != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "まとめ買いの取引は注文から操作してください", "code": "ORDER_TRANSACTION", "order_id": *current.OrderID})
+		return
+	}
+
+	// 落札後の支払い待ちの取引は、後から支払われないよう支払いインテントを先に取り消す
+	if current.Status == models.TransactionPaymentPending {
+		if err := cancelAuctionPaymentIntent(current); err != nil {
+			if errors.Is(err, errPaymentAlreadySucceeded) {
+				c.JSON(http.StatusConflict, gin.H{"error": "支払いが完了しているためキャンセルできません"})
+				return
+			}
+			fmt.Printf("Cancel Payment Intent Error: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel transaction"})
+			return
+		}
+	}
+
 	db := database.DBClient.Begin()
 	var tx models.Transaction
 
 	// 1. 取引の現在のステータスと存在を確認
 	if err := db.First(&tx, txID).Error; err != nil {
+		db.Rollback()
 		c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
 		return
 	}
 
 	// 2. 💡 重要なチェック: 既に発送済み（SHIPPED）でないかを確認
 	if tx.Status == "SHIPPED" || tx.Status == "COMPLETED" || tx.Status == "CANCELED" {
+		db.Rollback()
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Cancellation is not allowed for shipped or completed transactions."})
 		return
 	}
 
-	// 3. ステータスを CANCELED に更新
-	if err := db.Model(&models.Transaction{}).Where("id = ?", txID).Update("status", "CANCELED").Error; err != nil {
+	// 3. ステータスを CANCELED に更新 (同時にキャンセルされても在庫を二重に戻さないよう、確認した状態からのみ更新)
+	// 支払い待ちの場合は、取り消した後に新しい支払いインテントが作られていないことも確認する
+	guard := db.Where("id = ? AND status = ?", txID, tx.Status)
+	if tx.Status == models.TransactionPaymentPending {
+		guard = guard.Where("stripe_payment_id = ?", current.StripePaymentID)
+	}
+	result := guard.Model(&models.Transaction{}).Update("status", "CANCELED")
+	if result.Error != nil {
 		db.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel transaction"})
 		return
 	}
+	if result.RowsAffected == 0 {
+		db.Rollback()
+		c.JSON(http.StatusConflict, gin.H{"error": "Transaction status was changed. Please reload and try again"})
+		return
+	}
 
-	// 4. 💡 関連する商品（Item）のステータスもON_SALEに戻す（在庫復活）
-	db.First(&tx, txID)
-	if err := db.Model(&models.Item{}).Where("id = ?", tx.ItemID).Update("status", "ON_SALE").Error; err != nil {
+	// 4. 💡 購入された数量を在庫に戻し、売却済みであれば ON_SALE に戻す（在庫復活）
+	if err := restockCanceledTransaction(db, tx); err != nil {
 		db.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "商品の再販設定失敗"})
+		return
 	}
 
 	db.Commit()
@@ -167,9 +320,47 @@ func CancelTransactionHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Transaction canceled successfully"})
 }
 
+// restockCanceledTransaction キャンセルした取引の数量を在庫に戻し、売却済みであれば ON_SALE に戻す
+// 商品が削除済みの場合は何もしない
+func restockCanceledTransaction(db *gorm.DB, tx models.Transaction) error {
+	var item models.Item
+	if err := db.First(&item, tx.ItemID).Error; err != nil {
+		return nil
+	}
+	quantity := tx.Quantity
+	if quantity < 1 {
+		quantity = 1
+	}
+	if err := db.Model(&models.Item{}).Where("id = ?", item.ID).
+		Update("stock", gorm.Expr("stock + ?", quantity)).Error; err != nil {
+		return err
+	}
+	err := lifecycle.Move(db, &item, lifecycle.OnSale, lifecycle.ActorSystem)
+	if err != nil && !errors.Is(err, lifecycle.ErrInvalidTransition) && !errors.Is(err, lifecycle.ErrConflict) {
+		return err
+	}
+	// 落札された商品は定額では再販せず、下書きに戻して出品者に出品し直してもらう
+	if err == nil && item.ListingType == models.ListingAuction {
+		return lifecycle.MoveWith(db, &item, lifecycle.Draft, lifecycle.ActorSystem, map[string]interface{}{
+			"listing_type": models.ListingFixed,
+		})
+	}
+	return nil
+}
+
 // GetTransactionDetailHandler 取引詳細を取得
 func GetTransactionDetailHandler(c *gin.Context) {
-	txID := c.Param("tx_id")
+	txID, err := strconv.ParseUint(c.Param("tx_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction ID"})
+		return
+	}
+
+	// 取引の当事者以外は閲覧不可
+	_, role, ok := loadParticipantTransaction(c, txID)
+	if !ok {
+		return
+	}
 
 	var transaction models.Transaction
 	// 商品情報とその出品者、および購入者情報をまとめて取得
@@ -182,5 +373,17 @@ func GetTransactionDetailHandler(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"transaction": transaction})
+	response := gin.H{"transaction": transaction}
+	// 購入時点の商品情報 (購入後に商品が編集されていても、購入者が合意した内容を表示する)
+	if transaction.ItemRevisionID != nil {
+		var revision models.ItemRevision
+		if err := database.DBClient.First(&revision, *transaction.ItemRevisionID).Error; err == nil {
+			response["item_revision"] = revision
+		}
+	}
+	// 配送先は発送する出品者にのみ返す
+	if role == "SELLER" {
+		response["shipping_address"] = transaction.ShippingAddress
+	}
+	c.JSON(http.StatusOK, response)
 }
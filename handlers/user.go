@@ -6,6 +6,7 @@ import (
 	"strconv"
 
 	"github.com/Kousuke-irie/hackathon-backend/database"
+	"github.com/Kousuke-irie/hackathon-backend/middleware"
 	"github.com/Kousuke-irie/hackathon-backend/models"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -13,7 +14,7 @@ import (
 
 // UpdateUserRequest ユーザー更新用リクエスト
 type UpdateUserRequest struct {
-	ID        uint64 `json:"id" binding:"required"`
+	ID        uint64 `json:"id"` // 省略可。指定する場合はログインユーザー本人のIDのみ
 	Username  string `json:"username"`
 	Bio       string `json:"bio"`
 	IconURL   string `json:"icon_url"`
@@ -29,11 +30,15 @@ func UpdateUserHandler(c *gin.Context) {
 		return
 	}
 
+	if rejectForeignActor(c, req.ID) {
+		return
+	}
+
 	db := database.DBClient
 	var user models.User
 
-	// ユーザーの存在確認
-	if err := db.First(&user, req.ID).Error; err != nil {
+	// ユーザーの存在確認 (更新対象は常にログインユーザー本人)
+	if err := db.First(&user, middleware.CurrentUserID(c)).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
@@ -53,16 +58,12 @@ func UpdateUserHandler(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Profile updated", "user": user})
+	c.JSON(http.StatusOK, gin.H{"message": "Profile updated", "user": user.Self()})
 }
 
 // GetLikedItemsHandler ユーザーがいいねした商品一覧を取得
 func GetLikedItemsHandler(c *gin.Context) {
-	userID := c.GetHeader("X-User-ID")
-	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "User ID header is required"})
-		return
-	}
+	userID := middleware.CurrentUserID(c)
 
 	var items []models.Item
 	db := database.DBClient
@@ -83,8 +84,8 @@ func GetLikedItemsHandler(c *gin.Context) {
 
 // CheckItemLikedHandler 特定の商品に対してユーザーがLike済みかチェック
 func CheckItemLikedHandler(c *gin.Context) {
-	userID := c.GetHeader("X-User-ID")
-	if userID == "" {
+	userID := middleware.CurrentUserID(c)
+	if userID == 0 {
 		c.JSON(http.StatusOK, gin.H{"is_liked": false}) // 未ログインは当然いいねしていない
 		return
 	}
@@ -101,11 +102,7 @@ func CheckItemLikedHandler(c *gin.Context) {
 
 // GetMyPurchaseHistoryHandler 自分の購入履歴を取得
 func GetMyPurchaseHistoryHandler(c *gin.Context) {
-	userID := c.GetHeader("X-User-ID")
-	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
-		return
-	}
+	userID := middleware.CurrentUserID(c)
 
 	var transactions []models.Transaction
 	db := database.DBClient
@@ -124,23 +121,37 @@ func GetMyPurchaseHistoryHandler(c *gin.Context) {
 }
 
 // GetUserByIDHandler ユーザー詳細を取得
+// 💡 公開プロフィールのみ返し、誕生日は公開範囲を満たす閲覧者にのみ含める
 func GetUserByIDHandler(c *gin.Context) {
 	userID := c.Param("id")
 	var user models.User
 
-	// 💡 セキュリティのため、Emailなど非公開にすべき情報は返さないように調整
-	if err := database.DBClient.Select("id, username, icon_url, bio, following_count, follower_count, created_at").First(&user, userID).Error; err != nil {
+	if err := database.DBClient.First(&user, userID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"user": user})
+	viewerID := middleware.CurrentUserID(c)
+	ownerID := uint64(user.ID)
+	profile := user.PublicProfile()
+	if canView(user.Privacy.Birthdate, ownerID, viewerID) {
+		profile.Birthdate = user.Birthdate
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user": profile,
+		// フロント側でタブの表示可否を判定するため、閲覧可能な項目を返す
+		"can_view": gin.H{
+			"follow_list": canView(user.Privacy.FollowList, ownerID, viewerID),
+			"likes":       canView(user.Privacy.Likes, ownerID, viewerID),
+			"reviews":     canView(user.Privacy.Reviews, ownerID, viewerID),
+		},
+	})
 }
 
 // ToggleFollowHandler フォロー/解除を切り替える
 func ToggleFollowHandler(c *gin.Context) {
-	followerIDStr := c.GetHeader("X-User-ID")
-	followerID, _ := strconv.ParseUint(followerIDStr, 10, 64)
+	followerID := middleware.CurrentUserID(c)
 
 	followingIDStr := c.Param("id")
 	followingID, _ := strconv.ParseUint(followingIDStr, 10, 64)
@@ -149,6 +160,10 @@ func ToggleFollowHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "自分をフォローすることはできません"})
 		return
 	}
+	if isBlockedBetween(followerID, followingID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "このユーザーはフォローできません"})
+		return
+	}
 
 	var follow models.Follow
 	db := database.DBClient
@@ -178,17 +193,19 @@ func ToggleFollowHandler(c *gin.Context) {
 			return nil
 		})
 
-		// 通知作成
-		var follower models.User
-		db.First(&follower, followerID)
-		noti := models.Notification{
-			UserID:    followingID,
-			Type:      "SYSTEM",
-			Content:   fmt.Sprintf("%sさんにフォローされました", follower.Username),
-			RelatedID: followerID,
+		// 通知作成 (相手がミュートしている場合は通知しない)
+		if !hasMuted(followingID, followerID) {
+			var follower models.User
+			db.First(&follower, followerID)
+			noti := models.Notification{
+				UserID:    followingID,
+				Type:      "SYSTEM",
+				Content:   fmt.Sprintf("%sさんにフォローされました", follower.Username),
+				RelatedID: followerID,
+			}
+			db.Create(&noti)
+			BroadcastNotification(followingID, noti)
 		}
-		db.Create(&noti)
-		BroadcastNotification(followingID, noti)
 
 		c.JSON(http.StatusOK, gin.H{"status": "followed"})
 	}
@@ -196,7 +213,11 @@ func ToggleFollowHandler(c *gin.Context) {
 
 // GetFollowsHandler フォロー中またはフォロワーの一覧を取得
 func GetFollowsHandler(c *gin.Context) {
-	userID := c.Param("id")
+	owner, ok := loadVisibleProfileOwner(c, func(p models.PrivacySettings) string { return p.FollowList })
+	if !ok {
+		return
+	}
+	userID := owner.ID
 	mode := c.Query("mode") // "following" or "followers"
 
 	var users []models.User
@@ -219,8 +240,8 @@ func GetFollowsHandler(c *gin.Context) {
 
 // CheckFollowingHandler 特定のユーザーをフォローしているか確認
 func CheckFollowingHandler(c *gin.Context) {
-	followerID := c.GetHeader("X-User-ID")
-	if followerID == "" {
+	followerID := middleware.CurrentUserID(c)
+	if followerID == 0 {
 		c.JSON(http.StatusOK, gin.H{"is_following": false})
 		return
 	}
@@ -236,9 +257,13 @@ func CheckFollowingHandler(c *gin.Context) {
 
 // GetUserReviewsHandler 特定ユーザー宛の評価一覧を取得
 func GetUserReviewsHandler(c *gin.Context) {
-	userID := c.Param("id")
+	owner, ok := loadVisibleProfileOwner(c, func(p models.PrivacySettings) string { return p.Reviews })
+	if !ok {
+		return
+	}
+	userID := owner.ID
 	var reviews []models.Review
-	
+
 	err := database.DBClient.
 		Preload("Rater").
 		Preload("Transaction.Item").
@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Kousuke-irie/hackathon-backend/database"
+	"github.com/Kousuke-irie/hackathon-backend/gcs"
+	"github.com/Kousuke-irie/hackathon-backend/middleware"
+	"github.com/Kousuke-irie/hackathon-backend/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	auditVerificationApproved = "VERIFICATION_APPROVED"
+	auditVerificationRejected = "VERIFICATION_REJECTED"
+
+	// defaultVerificationPriceThreshold 本人確認なしで出品できる上限価格 (円)
+	defaultVerificationPriceThreshold = 100000
+)
+
+var (
+	errSelfReview      = errors.New("cannot review own verification")
+	errAlreadyReviewed = errors.New("verification is already reviewed")
+)
+
+// verificationPriceThreshold VERIFICATION_PRICE_THRESHOLD で上書きできる。0 以下なら制限しない
+func verificationPriceThreshold() int {
+	if v := os.Getenv("VERIFICATION_PRICE_THRESHOLD"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	return defaultVerificationPriceThreshold
+}
+
+// sellerNeedsVerification 上限価格を超える出品 (下書きは除く) で、出品者が本人確認済みでなければ true を返す
+func sellerNeedsVerification(seller *models.User, price int, status string) bool {
+	threshold := verificationPriceThreshold()
+	if status == "DRAFT" || threshold <= 0 || price <= threshold {
+		return false
+	}
+	return seller.VerifiedAt == nil
+}
+
+// requireVerifiedSellerForPrice 上限価格を超える出品 (下書きは除く) を本人確認済みの出品者に限定する
+// 拒否した場合はレスポンスを書き込んで false を返す
+func requireVerifiedSellerForPrice(c *gin.Context, price int, status string) bool {
+	if !sellerNeedsVerification(middleware.CurrentUser(c), price, status) {
+		return true
+	}
+	threshold := verificationPriceThreshold()
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":     fmt.Sprintf("%d円を超える商品を出品するには本人確認が必要です", threshold),
+		"code":      "VERIFICATION_REQUIRED",
+		"threshold": threshold,
+	})
+	return false
+}
+
+// verificationObjectPrefix 本人の書類を置く非公開バケット内のパス
+func verificationObjectPrefix(userID uint64) string {
+	return fmt.Sprintf("verifications/%d/", userID)
+}
+
+// GetVerificationUploadUrlHandler 本人確認書類のアップロード用URLを発行 (POST /users/me/verification/upload-url)
+func GetVerificationUploadUrlHandler(c *gin.Context) {
+	var req struct {
+		FileName    string `json:"file_name" binding:"required"`
+		ContentType string `json:"content_type" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: file_name and content_type are required"})
+		return
+	}
+
+	objectName := fmt.Sprintf("%s%d-%s", verificationObjectPrefix(middleware.CurrentUserID(c)), time.Now().UnixNano(), path.Base(req.FileName))
+	signedURL, err := gcs.GenerateSignedPrivateUploadURL(c.Request.Context(), objectName, req.ContentType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to generate upload URL: %v", err)})
+		return
+	}
+
+	// 書類は公開URLを持たないため、申請時にはオブジェクト名を送ってもらう
+	c.JSON(http.StatusOK, gin.H{
+		"uploadUrl":  signedURL,
+		"objectName": objectName,
+	})
+}
+
+// SubmitVerificationHandler 本人確認を申請 (POST /users/me/verification)
+func SubmitVerificationHandler(c *gin.Context) {
+	var req struct {
+		DocumentType    string   `json:"document_type" binding:"required"`
+		LegalName       string   `json:"legal_name" binding:"required"`
+		DocumentObjects []string `json:"document_objects" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userID := middleware.CurrentUserID(c)
+	if len(req.DocumentObjects) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one document is required"})
+		return
+	}
+	// 💡 他人の書類を指定できないよう、本人用のパスに置かれたものだけを受け付ける
+	prefix := verificationObjectPrefix(userID)
+	for _, obj := range req.DocumentObjects {
+		if !strings.HasPrefix(obj, prefix) || strings.Contains(obj, "..") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document object"})
+			return
+		}
+	}
+
+	if middleware.CurrentUser(c).VerifiedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "すでに本人確認済みです"})
+		return
+	}
+	var pendingCount int64
+	if err := database.DBClient.Model(&models.SellerVerification{}).
+		Where("user_id = ? AND status = ?", userID, models.VerificationPending).
+		Count(&pendingCount).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit verification"})
+		return
+	}
+	if pendingCount > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "審査中の申請があります"})
+		return
+	}
+
+	verification := models.SellerVerification{
+		UserID:          userID,
+		Status:          models.VerificationPending,
+		DocumentType:    req.DocumentType,
+		LegalName:       req.LegalName,
+		DocumentObjects: req.DocumentObjects,
+	}
+	if err := database.DBClient.Create(&verification).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit verification"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"verification": verification})
+}
+
+// GetMyVerificationHandler 自分の本人確認の状態と最新の申請を取得 (GET /users/me/verification)
+func GetMyVerificationHandler(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+
+	var latest models.SellerVerification
+	err := database.DBClient.Where("user_id = ?", user.ID).Order("id DESC").First(&latest).Error
+
+	response := gin.H{
+		"is_verified":     user.VerifiedAt != nil,
+		"price_threshold": verificationPriceThreshold(),
+	}
+	if err == nil {
+		response["verification"] = latest
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetVerificationsHandler 本人確認申請の一覧を取得 (GET /admin/verifications?status=PENDING)
+// 書類は短時間だけ有効な署名付きURLとして返す
+func GetVerificationsHandler(c *gin.Context) {
+	status := c.DefaultQuery("status", models.VerificationPending)
+
+	var verifications []models.SellerVerification
+	if err := database.DBClient.Where("status = ?", status).
+		Order("created_at ASC").
+		Limit(50).
+		Find(&verifications).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch verifications"})
+		return
+	}
+
+	type verificationForReview struct {
+		models.SellerVerification
+		DocumentURLs []string `json:"document_urls"`
+	}
+	result := make([]verificationForReview, len(verifications))
+	for i, v := range verifications {
+		result[i].SellerVerification = v
+		for _, obj := range v.DocumentObjects {
+			url, err := gcs.GenerateSignedReadURL(c.Request.Context(), obj)
+			if err != nil {
+				fmt.Printf("Verification Document URL Error: %v\n", err)
+				continue
+			}
+			result[i].DocumentURLs = append(result[i].DocumentURLs, url)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"verifications": result})
+}
+
+// ReviewVerificationHandler 本人確認申請を承認・却下 (PUT /admin/verifications/:id)
+// 審査中 (PENDING) の申請のみ APPROVED / REJECTED に遷移できる
+func ReviewVerificationHandler(c *gin.Context) {
+	var req struct {
+		Status string `json:"status" binding:"required"`
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status is required"})
+		return
+	}
+	if req.Status != models.VerificationApproved && req.Status != models.VerificationRejected {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Status must be APPROVED or REJECTED"})
+		return
+	}
+	if req.Status == models.VerificationRejected && req.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reason is required when rejecting"})
+		return
+	}
+
+	reviewerID := middleware.CurrentUserID(c)
+	var verification models.SellerVerification
+	err := database.DBClient.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&verification, c.Param("id")).Error; err != nil {
+			return err
+		}
+		if verification.UserID == reviewerID {
+			return errSelfReview
+		}
+
+		now := time.Now()
+		// 💡 同時に審査された場合に備え、PENDING の行だけを更新する
+		result := tx.Model(&models.SellerVerification{}).
+			Where("id = ? AND status = ?", verification.ID, models.VerificationPending).
+			Updates(map[string]interface{}{
+				"status":        req.Status,
+				"reviewer_id":   reviewerID,
+				"reject_reason": req.Reason,
+				"reviewed_at":   now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errAlreadyReviewed
+		}
+		verification.Status = req.Status
+		verification.ReviewerID = &reviewerID
+		verification.RejectReason = req.Reason
+		verification.ReviewedAt = &now
+
+		action := auditVerificationRejected
+		if req.Status == models.VerificationApproved {
+			action = auditVerificationApproved
+			if err := tx.Model(&models.User{}).Where("id = ?", verification.UserID).Update("verified_at", now).Error; err != nil {
+				return err
+			}
+		}
+		return recordAccountAudit(tx, verification.UserID, reviewerID, action, fmt.Sprintf("verification_id=%d", verification.ID))
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Verification not found"})
+		return
+	case errors.Is(err, errSelfReview):
+		c.JSON(http.StatusForbidden, gin.H{"error": "自分の申請は審査できません"})
+		return
+	case errors.Is(err, errAlreadyReviewed):
+		c.JSON(http.StatusConflict, gin.H{"error": "この申請はすでに審査済みです"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to review verification"})
+		return
+	}
+
+	// 申請者へ結果を通知
+	content := "本人確認が完了しました。認証済みバッジが表示されます"
+	if req.Status == models.VerificationRejected {
+		content = fmt.Sprintf("本人確認の申請が却下されました: %s", req.Reason)
+	}
+	noti := models.Notification{
+		UserID:    verification.UserID,
+		Type:      "SYSTEM",
+		Content:   content,
+		RelatedID: verification.ID,
+	}
+	database.DBClient.Create(&noti)
+	BroadcastNotification(verification.UserID, noti)
+
+	c.JSON(http.StatusOK, gin.H{"verification": verification})
+}
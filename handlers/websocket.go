@@ -1,13 +1,12 @@
 package handlers
 
 import (
-	"fmt"
 	"log"
 	"net/http"
-	"strconv"
 	"sync"
 
 	"github.com/Kousuke-irie/hackathon-backend/database"
+	"github.com/Kousuke-irie/hackathon-backend/middleware"
 	"github.com/Kousuke-irie/hackathon-backend/models"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -27,13 +26,7 @@ var Manager = ClientManager{
 }
 
 func WSNotificationHandler(c *gin.Context) {
-	userIDStr := c.Query("user_id")
-	if userIDStr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
-		return
-	}
-	var userID uint64
-	fmt.Sscanf(userIDStr, "%d", &userID)
+	userID := middleware.CurrentUserID(c)
 
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
@@ -88,17 +81,23 @@ func PostMessageHandler(c *gin.Context) {
 		return
 	}
 
-	senderIDStr := c.GetHeader("X-User-ID")
-	senderID, _ := strconv.ParseUint(senderIDStr, 10, 64)
-	msg.SenderID = senderID
+	msg.SenderID = middleware.CurrentUserID(c)
+
+	// ブロック関係にある相手とはやり取りできない
+	if isBlockedBetween(msg.SenderID, msg.ReceiverID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "このユーザーにはメッセージを送信できません"})
+		return
+	}
 
 	if err := database.DBClient.Create(&msg).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save message"})
 		return
 	}
 
-	// 相手がオンラインならWSで即時送信
-	BroadcastChatMessage(msg.ReceiverID, msg)
+	// 相手がオンラインならWSで即時送信 (相手がミュートしている場合は通知しない)
+	if !hasMuted(msg.ReceiverID, msg.SenderID) {
+		BroadcastChatMessage(msg.ReceiverID, msg)
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": msg})
 }
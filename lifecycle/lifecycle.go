@@ -0,0 +1,151 @@
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Kousuke-irie/hackathon-backend/models"
+	"gorm.io/gorm"
+)
+
+// 商品の状態 (Item.Status)
+const (
+	Draft    = "DRAFT"
+	OnSale   = "ON_SALE"
+	Reserved = "RESERVED" // 購入手続き中 (決済待ち)
+	Sold     = "SOLD"
+	Paused   = "PAUSED"
+	Archived = "ARCHIVED"
+)
+
+// Actor 状態を変更する主体
+type Actor string
+
+const (
+	// ActorSeller 商品の出品者
+	ActorSeller Actor = "SELLER"
+	// ActorBuyer 購入しようとしているユーザー
+	ActorBuyer Actor = "BUYER"
+	// ActorSystem 取引のキャンセルや退会処理、オークションの終了など、サーバー側の処理
+	ActorSystem Actor = "SYSTEM"
+)
+
+var (
+	// ErrInvalidTransition 許可されていない状態遷移
+	ErrInvalidTransition = errors.New("invalid item status transition")
+	// ErrConflict 確認後に他の処理が状態を変更した
+	ErrConflict = errors.New("item status was changed concurrently")
+)
+
+type edge struct {
+	from, to string
+}
+
+// transitions 許可される遷移と、それを行える主体
+var transitions = map[edge][]Actor{
+	{Draft, OnSale}:    {ActorSeller, ActorSystem}, // 予約出品 (publish_at) による公開を含む
+	{Draft, Archived}:  {ActorSeller},
+	{OnSale, Draft}:    {ActorSeller, ActorSystem},
+	{OnSale, Paused}:   {ActorSeller},
+	{OnSale, Archived}: {ActorSeller},
+	{OnSale, Reserved}: {ActorBuyer},  // 決済手続きの開始 (他の購入者を締め出す)
+	{OnSale, Sold}:     {ActorSystem}, // オークションの落札 (支払いは落札後に行う)
+	{Paused, OnSale}:   {ActorSeller},
+	{Paused, Draft}:    {ActorSeller, ActorSystem},
+	{Paused, Archived}: {ActorSeller},
+	{Archived, Draft}:  {ActorSeller},
+	{Reserved, Sold}:   {ActorBuyer, ActorSystem},
+	{Reserved, OnSale}: {ActorBuyer, ActorSystem}, // 購入手続きの中止・期限切れ
+	{Sold, OnSale}:     {ActorSystem},             // 発送前の取引キャンセル
+}
+
+// CanTransition actor が商品を from から to に変更できるかを返す
+// 同じ状態への変更 (内容だけの編集) は、出品者が編集できる状態であれば許可する
+func CanTransition(from, to string, actor Actor) bool {
+	if from == to {
+		return actor == ActorSeller && IsEditable(from)
+	}
+	for _, a := range transitions[edge{from, to}] {
+		if a == actor {
+			return true
+		}
+	}
+	return false
+}
+
+// Check CanTransition の結果をエラーとして返す
+func Check(from, to string, actor Actor) error {
+	if !CanTransition(from, to, actor) {
+		return fmt.Errorf("%w: %s -> %s by %s", ErrInvalidTransition, from, to, actor)
+	}
+	return nil
+}
+
+// IsInitial 出品時に指定できる状態か
+func IsInitial(status string) bool {
+	return status == Draft || status == OnSale
+}
+
+// IsEditable 出品者が商品情報を編集できる状態か (購入手続き中・売却済みは不可)
+func IsEditable(status string) bool {
+	return status == Draft || status == OnSale || status == Paused || status == Archived
+}
+
+// CanDelete 出品者が商品を削除できる状態か
+func CanDelete(status string) bool {
+	return IsEditable(status)
+}
+
+// SourcesOf actor が to に変更できる元の状態の一覧 (一括更新の条件に使う)
+func SourcesOf(to string, actor Actor) []string {
+	var sources []string
+	for e, actors := range transitions {
+		if e.to != to {
+			continue
+		}
+		for _, a := range actors {
+			if a == actor {
+				sources = append(sources, e.from)
+				break
+			}
+		}
+	}
+	return sources
+}
+
+// Move 商品の状態を遷移させる
+// item.Status から変わっていない場合のみ更新するため、同時に購入・編集されても二重に遷移しない
+func Move(tx *gorm.DB, item *models.Item, to string, actor Actor) error {
+	return MoveWith(tx, item, to, actor, nil)
+}
+
+// MoveWith 状態の遷移と同時に他の列 (予約者など) も更新する
+// tx に付けた Where 条件も更新条件に含まれるため、予約者の一致なども同時に確認できる
+func MoveWith(tx *gorm.DB, item *models.Item, to string, actor Actor, updates map[string]interface{}) error {
+	if err := Check(item.Status, to, actor); err != nil {
+		return err
+	}
+
+	values := map[string]interface{}{"status": to}
+	// 予約出品は下書きにのみ設定できるため、下書きでなくなったら取り消す
+	if item.Status == Draft && to != Draft {
+		values["publish_at"] = nil
+	}
+	for k, v := range updates {
+		values[k] = v
+	}
+	result := tx.Model(&models.Item{}).
+		Where("id = ? AND status = ?", item.ID, item.Status).
+		Updates(values)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrConflict
+	}
+	item.Status = to
+	if _, cleared := values["publish_at"]; cleared {
+		item.PublishAt = nil
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package lifecycle
+
+import (
+	"errors"
+	"sort"
+	"testing"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		name  string
+		from  string
+		to    string
+		actor Actor
+		want  bool
+	}{
+		{"seller publishes draft", Draft, OnSale, ActorSeller, true},
+		{"seller pauses listing", OnSale, Paused, ActorSeller, true},
+		{"seller resumes listing", Paused, OnSale, ActorSeller, true},
+		{"seller archives listing", OnSale, Archived, ActorSeller, true},
+		{"seller restores archived as draft", Archived, Draft, ActorSeller, true},
+		{"buyer reserves listing", OnSale, Reserved, ActorBuyer, true},
+		{"buyer completes reservation", Reserved, Sold, ActorBuyer, true},
+		{"system expires reservation", Reserved, OnSale, ActorSystem, true},
+		{"system relists after cancellation", Sold, OnSale, ActorSystem, true},
+		{"system unpublishes on withdrawal", OnSale, Draft, ActorSystem, true},
+		{"system publishes scheduled draft", Draft, OnSale, ActorSystem, true},
+		{"system closes auction for winner", OnSale, Sold, ActorSystem, true},
+		{"seller edits listing in place", OnSale, OnSale, ActorSeller, true},
+
+		{"seller cannot mark sold", OnSale, Sold, ActorSeller, false},
+		{"buyer cannot skip reservation", OnSale, Sold, ActorBuyer, false},
+		{"seller cannot relist sold item", Sold, OnSale, ActorSeller, false},
+		{"seller cannot reserve", OnSale, Reserved, ActorSeller, false},
+		{"seller cannot cancel reservation", Reserved, OnSale, ActorSeller, false},
+		{"seller cannot edit reserved item", Reserved, Reserved, ActorSeller, false},
+		{"seller cannot edit sold item", Sold, Sold, ActorSeller, false},
+		{"buyer cannot buy paused item", Paused, Sold, ActorBuyer, false},
+		{"buyer cannot reserve draft", Draft, Reserved, ActorBuyer, false},
+		{"buyer cannot publish draft", Draft, OnSale, ActorBuyer, false},
+		{"buyer cannot relist sold item", Sold, OnSale, ActorBuyer, false},
+		{"archived cannot go on sale directly", Archived, OnSale, ActorSeller, false},
+		{"draft cannot be paused", Draft, Paused, ActorSeller, false},
+		{"unknown status", "UNKNOWN", OnSale, ActorSeller, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CanTransition(tt.from, tt.to, tt.actor); got != tt.want {
+				t.Errorf("CanTransition(%s, %s, %s) = %v, want %v", tt.from, tt.to, tt.actor, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    string
+		to      string
+		actor   Actor
+		wantErr error
+	}{
+		{"allowed", Draft, OnSale, ActorSeller, nil},
+		{"forbidden", OnSale, Sold, ActorSeller, ErrInvalidTransition},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Check(tt.from, tt.to, tt.actor)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Check(%s, %s, %s) = %v, want %v", tt.from, tt.to, tt.actor, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStatusPredicates(t *testing.T) {
+	tests := []struct {
+		status    string
+		initial   bool
+		editable  bool
+		deletable bool
+	}{
+		{Draft, true, true, true},
+		{OnSale, true, true, true},
+		{Paused, false, true, true},
+		{Archived, false, true, true},
+		{Reserved, false, false, false},
+		{Sold, false, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			if got := IsInitial(tt.status); got != tt.initial {
+				t.Errorf("IsInitial(%s) = %v, want %v", tt.status, got, tt.initial)
+			}
+			if got := IsEditable(tt.status); got != tt.editable {
+				t.Errorf("IsEditable(%s) = %v, want %v", tt.status, got, tt.editable)
+			}
+			if got := CanDelete(tt.status); got != tt.deletable {
+				t.Errorf("CanDelete(%s) = %v, want %v", tt.status, got, tt.deletable)
+			}
+		})
+	}
+}
+
+func TestSourcesOf(t *testing.T) {
+	tests := []struct {
+		to    string
+		actor Actor
+		want  []string
+	}{
+		{Draft, ActorSystem, []string{OnSale, Paused}},
+		{Sold, ActorBuyer, []string{Reserved}},
+		{Sold, ActorSystem, []string{OnSale, Reserved}},
+		{Sold, ActorSeller, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.to+"/"+string(tt.actor), func(t *testing.T) {
+			got := SourcesOf(tt.to, tt.actor)
+			sort.Strings(got)
+			if len(got) != len(tt.want) {
+				t.Fatalf("SourcesOf(%s, %s) = %v, want %v", tt.to, tt.actor, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("SourcesOf(%s, %s) = %v, want %v", tt.to, tt.actor, got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -4,11 +4,14 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/Kousuke-irie/hackathon-backend/database"
 	"github.com/Kousuke-irie/hackathon-backend/firebase"
 	"github.com/Kousuke-irie/hackathon-backend/gcs"
+	"github.com/Kousuke-irie/hackathon-backend/handlers"
 	"github.com/Kousuke-irie/hackathon-backend/routes"
+	"github.com/Kousuke-irie/hackathon-backend/session"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
@@ -22,11 +25,27 @@ func main() {
 	if err := firebase.InitFirebase(); err != nil {
 		log.Fatalf("Firebase initialization failed: %v", err)
 	}
+	if err := session.Init(); err != nil {
+		log.Fatalf("Session initialization failed: %v", err)
+	}
 
 	if err := gcs.InitStorageClient(); err != nil {
 		log.Fatalf("Warning: GCS client initialization failed. Item upload functionality will be limited: %v", err)
 	}
 
+	// 期限切れの購入手続き (RESERVED) を定期的に解放する
+	handlers.StartReservationSweeper(time.Minute)
+	// 公開日時を過ぎた予約出品を公開する
+	handlers.StartPublishScheduler(time.Minute)
+	// 期限切れの値下げ交渉を EXPIRED にする
+	handlers.StartOfferSweeper(time.Minute)
+	// 終了日時を過ぎたオークションを締め切り、落札者との取引を作成する
+	handlers.StartAuctionCloser(30 * time.Second)
+	// 支払い期限を過ぎた落札の取引をキャンセルする
+	handlers.StartAuctionPaymentSweeper(time.Minute)
+	// 閲覧・スワイプ・コメント・購入を商品ごとの日別集計にまとめる
+	handlers.StartStatsRollup(10 * time.Minute)
+
 	// 2. ルーティング設定
 	r := gin.Default()
 
@@ -40,7 +59,7 @@ func main() {
 	*/
 	config.AllowAllOrigins = true
 	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
-	config.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization", "X-User-ID"}
+	config.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization"}
 	config.AllowCredentials = false
 	r.Use(cors.New(config))
 
@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Kousuke-irie/hackathon-backend/database"
+	"github.com/Kousuke-irie/hackathon-backend/models"
+	"github.com/Kousuke-irie/hackathon-backend/session"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// contextUserKey gin.Context に認証済みユーザーを格納するキー
+	contextUserKey = "currentUser"
+	// contextSessionKey gin.Context に現在のセッションIDを格納するキー
+	contextSessionKey = "currentSessionID"
+)
+
+var (
+	errNoToken        = errors.New("bearer token is missing")
+	errSessionRevoked = errors.New("session is revoked or expired")
+)
+
+// AuthRequired Authorization: Bearer <アクセストークン> を検証し、ユーザーをコンテキストに格納する
+// アクセストークンは /login で発行したもので、セッションが失効していれば拒否する
+// 検証に失敗した場合は 401 を返して処理を中断する
+func AuthRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, sessionID, err := authenticate(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+		c.Set(contextUserKey, user)
+		c.Set(contextSessionKey, sessionID)
+		c.Next()
+	}
+}
+
+// OptionalAuth トークンがあれば検証してユーザーを格納するが、無くても処理を続行する (公開API用)
+func OptionalAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if user, sessionID, err := authenticate(c); err == nil {
+			c.Set(contextUserKey, user)
+			c.Set(contextSessionKey, sessionID)
+		}
+		c.Next()
+	}
+}
+
+// CurrentUser 認証済みユーザーを返す。未認証の場合は nil
+func CurrentUser(c *gin.Context) *models.User {
+	v, ok := c.Get(contextUserKey)
+	if !ok {
+		return nil
+	}
+	user, _ := v.(*models.User)
+	return user
+}
+
+// CurrentUserID 認証済みユーザーのIDを返す。未認証の場合は 0
+func CurrentUserID(c *gin.Context) uint64 {
+	user := CurrentUser(c)
+	if user == nil {
+		return 0
+	}
+	return uint64(user.ID)
+}
+
+// CurrentSessionID 現在のリクエストのセッションIDを返す。未認証の場合は 0
+func CurrentSessionID(c *gin.Context) uint64 {
+	return c.GetUint64(contextSessionKey)
+}
+
+func authenticate(c *gin.Context) (*models.User, uint64, error) {
+	accessToken := bearerToken(c)
+	if accessToken == "" {
+		return nil, 0, errNoToken
+	}
+
+	claims, err := session.ParseAccessToken(accessToken)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// 失効 (ログアウト・全端末ログアウト) 済みのセッションは拒否する
+	db := database.DBClient
+	var count int64
+	if err := db.Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL AND expires_at > ?", claims.SessionID, claims.UserID, time.Now()).
+		Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+	if count == 0 {
+		return nil, 0, errSessionRevoked
+	}
+
+	var user models.User
+	if err := db.First(&user, claims.UserID).Error; err != nil {
+		return nil, 0, err
+	}
+	return &user, claims.SessionID, nil
+}
+
+// bearerToken Authorization ヘッダーからトークンを取り出す
+// WebSocket はブラウザからヘッダーを付けられないため、クエリ ?token= も受け付ける
+func bearerToken(c *gin.Context) string {
+	header := c.GetHeader("Authorization")
+	if token, ok := strings.CutPrefix(header, "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return c.Query("token")
+}
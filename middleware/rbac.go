@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/Kousuke-irie/hackathon-backend/models"
+	"github.com/gin-gonic/gin"
+)
+
+// Permission 役割に付与される操作権限
+type Permission string
+
+const (
+	// PermAccessAdmin 管理画面 (/admin) へのアクセス
+	PermAccessAdmin Permission = "access_admin"
+	// PermModerateContent コメントや投稿の削除などのモデレーション
+	PermModerateContent Permission = "moderate_content"
+	// PermManageUsers ユーザーの役割変更などのユーザー管理
+	PermManageUsers Permission = "manage_users"
+	// PermReviewVerifications 出品者の本人確認書類の審査
+	PermReviewVerifications Permission = "review_verifications"
+)
+
+var rolePermissions = map[string][]Permission{
+	models.RoleModerator: {PermAccessAdmin, PermModerateContent, PermReviewVerifications},
+	models.RoleAdmin:     {PermAccessAdmin, PermModerateContent, PermManageUsers, PermReviewVerifications},
+}
+
+// Can ユーザーが権限を持っているかを返す
+func Can(user *models.User, perm Permission) bool {
+	if user == nil {
+		return false
+	}
+	for _, p := range rolePermissions[user.Role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission ログインユーザーが権限を持っているかを返す (ハンドラ内での判定用)
+func HasPermission(c *gin.Context, perm Permission) bool {
+	return Can(CurrentUser(c), perm)
+}
+
+// RequirePermission 権限を持たないユーザーを 403 で拒否する (AuthRequired の後に使う)
+func RequirePermission(perm Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasPermission(c, perm) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient permission"})
+			return
+		}
+		c.Next()
+	}
+}
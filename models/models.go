@@ -1,44 +1,232 @@
 package models
 
 import (
+	"encoding/json"
+	"strings"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // User ユーザー
+// JSON には常に公開プロフィールとして出力される (本人向けには SelfUser を使う)
 type User struct {
-	ID             uint      `gorm:"primaryKey" json:"id"`
-	FirebaseUID    string    `gorm:"size:255;uniqueIndex;not null" json:"firebase_uid"`
-	Email          string    `gorm:"size:255;uniqueIndex;not null" json:"email"`
+	ID             uint            `gorm:"primaryKey" json:"id"`
+	FirebaseUID    string          `gorm:"size:255;uniqueIndex;not null" json:"-"`
+	Email          string          `gorm:"size:255;uniqueIndex;not null" json:"email"`
+	Username       string          `json:"username"`
+	IconURL        string          `json:"icon_url"`
+	Bio            string          `json:"bio" gorm:"type:text"`
+	Address        string          `gorm:"type:text;serializer:encrypted" json:"address"` // 暗号化して保存
+	Birthdate      string          `json:"birthdate"`
+	FollowingCount int             `gorm:"default:0" json:"following_count"`
+	FollowerCount  int             `gorm:"default:0" json:"follower_count"`
+	Role           string          `gorm:"type:enum('USER','MODERATOR','ADMIN');default:'USER';not null" json:"role"`
+	Privacy        PrivacySettings `gorm:"embedded;embeddedPrefix:privacy_" json:"privacy"`
+	VerifiedAt     *time.Time      `json:"verified_at,omitempty"`  // 本人確認 (出品者認証) の承認日時
+	WithdrawnAt    *time.Time      `json:"withdrawn_at,omitempty"` // 退会日時 (退会済みユーザーは匿名化される)
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+// 公開範囲 (PrivacySettings の各項目)
+const (
+	VisibilityPublic    = "PUBLIC"
+	VisibilityFollowers = "FOLLOWERS" // 自分をフォローしているユーザーのみ
+	VisibilityPrivate   = "PRIVATE"
+)
+
+// PrivacySettings プロフィール項目ごとの公開範囲
+type PrivacySettings struct {
+	FollowList string `gorm:"type:enum('PUBLIC','FOLLOWERS','PRIVATE');default:'PUBLIC';not null" json:"follow_list"`
+	Likes      string `gorm:"type:enum('PUBLIC','FOLLOWERS','PRIVATE');default:'PRIVATE';not null" json:"likes"`
+	Reviews    string `gorm:"type:enum('PUBLIC','FOLLOWERS','PRIVATE');default:'PUBLIC';not null" json:"reviews"`
+	Birthdate  string `gorm:"type:enum('PUBLIC','FOLLOWERS','PRIVATE');default:'PRIVATE';not null" json:"birthdate"`
+}
+
+// DefaultPrivacySettings 新規ユーザーの公開範囲
+func DefaultPrivacySettings() PrivacySettings {
+	return PrivacySettings{
+		FollowList: VisibilityPublic,
+		Likes:      VisibilityPrivate,
+		Reviews:    VisibilityPublic,
+		Birthdate:  VisibilityPrivate,
+	}
+}
+
+// PublicUser 他のユーザーに公開するプロフィール
+type PublicUser struct {
+	ID             uint      `json:"id"`
 	Username       string    `json:"username"`
 	IconURL        string    `json:"icon_url"`
-	Bio            string    `json:"bio" gorm:"type:text"`
-	Address        string    `json:"address"`
-	Birthdate      string    `json:"birthdate"`
-	FollowingCount int       `gorm:"default:0" json:"following_count"`
-	FollowerCount  int       `gorm:"default:0" json:"follower_count"`
+	Bio            string    `json:"bio"`
+	Birthdate      string    `json:"birthdate,omitempty"` // 公開範囲内の閲覧者にのみ設定する
+	FollowingCount int       `json:"following_count"`
+	FollowerCount  int       `json:"follower_count"`
+	IsVerified     bool      `json:"is_verified"` // 本人確認済みバッジ
+	IsWithdrawn    bool      `json:"is_withdrawn,omitempty"`
 	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
 }
 
+// PublicProfile 公開プロフィールに変換する (メールアドレス・住所・誕生日などは含めない)
+func (u User) PublicProfile() PublicUser {
+	return PublicUser{
+		ID:             u.ID,
+		Username:       u.Username,
+		IconURL:        u.IconURL,
+		Bio:            u.Bio,
+		FollowingCount: u.FollowingCount,
+		FollowerCount:  u.FollowerCount,
+		IsVerified:     u.VerifiedAt != nil,
+		IsWithdrawn:    u.WithdrawnAt != nil,
+		CreatedAt:      u.CreatedAt,
+	}
+}
+
+// MarshalJSON Preload されたリレーション (Seller, Buyer など) からも非公開項目が漏れないよう、公開プロフィールとして出力する
+func (u User) MarshalJSON() ([]byte, error) {
+	return json.Marshal(u.PublicProfile())
+}
+
+// SelfUser 本人向けのユーザー情報 (メールアドレス・住所・公開範囲を含む)
+type SelfUser User
+
+// Self 本人向けの表現に変換する
+func (u User) Self() SelfUser {
+	return SelfUser(u)
+}
+
+// ユーザーの役割 (User.Role)
+const (
+	RoleUser      = "USER"
+	RoleModerator = "MODERATOR"
+	RoleAdmin     = "ADMIN"
+)
+
 // Item 商品
 type Item struct {
-	ID            uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
-	SellerID      uint64    `gorm:"not null;index" json:"seller_id"`
-	Title         string    `gorm:"type:varchar(255);not null" json:"title"`
-	Description   string    `gorm:"type:text;not null" json:"description"`
-	Price         int       `gorm:"not null" json:"price"`
-	ImageURL      string    `gorm:"type:text;not null" json:"image_url"`
-	Status        string    `gorm:"type:enum('ON_SALE','SOLD','DRAFT');default:'ON_SALE';not null" json:"status"`
-	AITags        string    `gorm:"type:json" json:"ai_tags"`               // MySQL 5.7+ JSON型
-	CategoryID    uint      `json:"category_id"`                            // カテゴリID (1:トップス, 2:ボトムス など)
-	Condition     string    `gorm:"type:varchar(50)" json:"condition"`      // 商品の状態 (新品、中古など)
-	ShippingPayer string    `gorm:"type:varchar(50)" json:"shipping_payer"` // 配送負担者 (seller/buyer)
-	ShippingFee   int       `json:"shipping_fee"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID            uint64         `gorm:"primaryKey;autoIncrement" json:"id"`
+	SellerID      uint64         `gorm:"not null;index" json:"seller_id"`
+	Title         string         `gorm:"type:varchar(255);not null" json:"title"`
+	Description   string         `gorm:"type:text;not null" json:"description"`
+	Price         int            `gorm:"not null" json:"price"`
+	ImageURL      string         `gorm:"type:text;not null" json:"image_url"` // 旧クライアント向け: 画像URLのJSON配列 (ItemImage から生成)
+	CoverImageURL string         `gorm:"type:text" json:"cover_image_url"`    // 一覧のサムネイル用 (ItemImage のカバー画像)
+	Status        string         `gorm:"type:enum('ON_SALE','SOLD','DRAFT','PAUSED','ARCHIVED','RESERVED');default:'ON_SALE';not null" json:"status"`
+	AITags        string         `gorm:"type:json" json:"ai_tags"`               // MySQL 5.7+ JSON型
+	CategoryID    uint           `json:"category_id"`                            // カテゴリID (1:トップス, 2:ボトムス など)
+	Condition     string         `gorm:"type:varchar(50)" json:"condition"`      // 商品の状態 (新品、中古など)
+	ShippingPayer string         `gorm:"type:varchar(50)" json:"shipping_payer"` // 配送負担者 (seller/buyer)
+	ShippingFee   int            `json:"shipping_fee"`
+	Stock         int            `gorm:"not null;default:1" json:"stock"`                                           // 在庫数 (購入手続き中の StockHold の数量は除く)。0 になると SOLD
+	ListingType   string         `gorm:"type:enum('FIXED','AUCTION');default:'FIXED';not null" json:"listing_type"` // 販売形式 (オークション中・落札済みは AUCTION)
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`                    // 論理削除 (出品者が削除した商品)
+	PublishAt     *time.Time     `gorm:"index" json:"publish_at,omitempty"` // 予約出品の公開日時 (下書きのみ)
+
+	// 購入手続き中 (RESERVED) の予約情報
+	ReservedByID      *uint64    `gorm:"index" json:"-"`
+	ReservedUntil     *time.Time `gorm:"index" json:"reserved_until,omitempty"`
+	PaymentIntentID   string     `gorm:"type:varchar(255)" json:"-"`
+	ReservedQuantity  int        `gorm:"not null;default:0" json:"-"` // 購入手続き中の数量
+	ReservedOfferID   *uint64    `json:"-"`                           // 承諾された値下げ交渉の価格で購入手続き中の場合の Offer
+	ReservedAddressID *uint64    `gorm:"index" json:"-"`              // 購入手続きの開始時に選んだ配送先 (購入の確定時にこの住所を記録する)
 
 	// Relations
-	Seller User `gorm:"foreignKey:SellerID" json:"seller,omitempty"`
+	Seller     User            `gorm:"foreignKey:SellerID" json:"seller,omitempty"`
+	Images     []ItemImage     `gorm:"foreignKey:ItemID" json:"images,omitempty"`
+	Attributes []ItemAttribute `gorm:"foreignKey:ItemID" json:"attributes,omitempty"`
+}
+
+// StockHold 在庫が複数ある商品の購入手続きで確保した数量 (購入者ごとに1件)
+// 確保した数量は items.stock から引いておき、商品は ON_SALE のまま残りの在庫を他の購入者も購入できる
+type StockHold struct {
+	ID              uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
+	ItemID          uint64    `gorm:"not null;uniqueIndex:idx_stock_hold_item_buyer,priority:1" json:"item_id"`
+	BuyerID         uint64    `gorm:"not null;uniqueIndex:idx_stock_hold_item_buyer,priority:2" json:"buyer_id"`
+	Quantity        int       `gorm:"not null" json:"quantity"`
+	OfferID         *uint64   `json:"-"` // 承諾された値下げ交渉の価格で購入手続き中の場合の Offer
+	AddressID       uint64    `gorm:"not null" json:"-"`
+	PaymentIntentID string    `gorm:"type:varchar(255);index" json:"-"`
+	ReservedUntil   time.Time `gorm:"index" json:"reserved_until"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// ItemPriceHistory 商品の価格変更履歴
+type ItemPriceHistory struct {
+	ID        uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
+	ItemID    uint64    `gorm:"not null;index" json:"item_id"`
+	OldPrice  int       `gorm:"not null" json:"old_price"`
+	NewPrice  int       `gorm:"not null" json:"new_price"`
+	ChangedBy uint64    `gorm:"not null" json:"changed_by"` // 変更したユーザー (出品者)
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ItemRevision 商品情報の版 (出品・編集のたびに内容全体を保存する)
+// 取引には購入時点の版を紐付け、購入後に説明文などが変わっても合意した内容を確認できるようにする
+type ItemRevision struct {
+	ID            uint64       `gorm:"primaryKey;autoIncrement" json:"id"`
+	ItemID        uint64       `gorm:"not null;uniqueIndex:idx_item_revision_version" json:"item_id"`
+	Version       int          `gorm:"not null;uniqueIndex:idx_item_revision_version" json:"version"` // 商品ごとに1から連番
+	EditorID      uint64       `gorm:"not null" json:"editor_id"`
+	ChangedFields []string     `gorm:"type:json;serializer:json" json:"changed_fields"` // 前の版から変わった項目 (最初の版は全項目)
+	Snapshot      ItemSnapshot `gorm:"type:json;serializer:json" json:"snapshot"`
+	CreatedAt     time.Time    `json:"created_at"`
+}
+
+// ItemSnapshot 版として保存する商品情報 (出品状態の変更は版に含めない)
+type ItemSnapshot struct {
+	Title         string            `json:"title"`
+	Description   string            `json:"description"`
+	Price         int               `json:"price"`
+	CategoryID    uint              `json:"category_id"`
+	Condition     string            `json:"condition"`
+	ShippingPayer string            `json:"shipping_payer"`
+	ShippingFee   int               `json:"shipping_fee"`
+	Attributes    map[string]string `json:"attributes,omitempty"`
+	ImageURLs     []string          `json:"image_urls"` // 表示順
+	CoverImageURL string            `json:"cover_image_url"`
+}
+
+// ItemImage 商品画像 (Position 順に表示し、IsCover の1枚を一覧のサムネイルに使う)
+type ItemImage struct {
+	ID        uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
+	ItemID    uint64    `gorm:"not null;index" json:"item_id"`
+	URL       string    `gorm:"type:text;not null" json:"url"`
+	Position  int       `gorm:"not null;default:0" json:"position"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
+	IsCover   bool      `gorm:"default:false;not null" json:"is_cover"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MaxItemImages 1商品あたりの画像の上限
+const MaxItemImages = 10
+
+// SplitImageURLs Item.ImageURL の値を画像URLの一覧に分解する
+// JSON配列 (["a","b"]) と、単一のURL文字列の両方に対応する
+func SplitImageURLs(raw string) []string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || raw == "[]" {
+		return nil
+	}
+	var urls []string
+	if strings.HasPrefix(raw, "[") {
+		if err := json.Unmarshal([]byte(raw), &urls); err != nil {
+			return nil
+		}
+	} else {
+		urls = []string{raw}
+	}
+
+	result := make([]string, 0, len(urls))
+	for _, u := range urls {
+		if u = strings.TrimSpace(u); u != "" {
+			result = append(result, u)
+		}
+	}
+	return result
 }
 
 // Transaction 取引
@@ -47,23 +235,226 @@ type Transaction struct {
 	ItemID          uint64    `gorm:"not null;index" json:"item_id"`
 	BuyerID         uint64    `gorm:"not null;index" json:"buyer_id"`
 	SellerID        uint64    `gorm:"not null" json:"seller_id"`
-	PriceSnapshot   int       `gorm:"not null" json:"price_snapshot"`
+	PriceSnapshot   int       `gorm:"not null" json:"price_snapshot"` // 購入時点の単価
+	Quantity        int       `gorm:"not null;default:1" json:"quantity"`
 	StripePaymentID string    `gorm:"type:varchar(255)" json:"stripe_payment_id"`
+	CreatedAt       time.Time `gorm:"index" json:"created_at"`
+	UpdatedAt       time.Time `gorm:"index" json:"updated_at"` // 状態が変わった取引の日別集計を作り直すために使う
+	Status          string    `gorm:"type:enum('PAYMENT_PENDING','PURCHASED','SHIPPED','COMPLETED','CANCELED');default:'PURCHASED';not null" json:"status"`
+
+	// まとめ買いの場合の注文 (Order)。状態は注文と同じに保つ
+	OrderID *uint64 `gorm:"index" json:"order_id,omitempty"`
+
+	// 値下げ交渉で承諾された価格で購入した場合の Offer
+	OfferID *uint64 `gorm:"<-:create;index" json:"offer_id,omitempty"`
+
+	// 落札後の支払い期限 (支払い待ちの取引のみ)。過ぎると取引をキャンセルする
+	PaymentDeadline *time.Time `gorm:"<-:create;index" json:"payment_deadline,omitempty"`
+
+	// 購入時点の商品情報の版 (ItemRevision)
+	ItemRevisionID *uint64 `gorm:"<-:create;index" json:"item_revision_id"`
+
+	// 購入時点の配送先。出品者のみ閲覧できるため JSON には含めない
+	ShippingAddress ShippingAddress `gorm:"embedded;embeddedPrefix:shipping_" json:"-"`
+
+	// Relations
+	Item  Item `gorm:"foreignKey:ItemID" json:"item,omitempty"`
+	Buyer User `gorm:"foreignKey:BuyerID" json:"buyer,omitempty"`
+}
+
+// TransactionPaymentPending オークションの落札後、落札者の支払いを待っている取引の状態
+const TransactionPaymentPending = "PAYMENT_PENDING"
+
+// Order まとめ買いの注文 (同じ出品者の複数の商品を1回の決済・1回の発送で購入する)
+// 購入の確定時に商品ごとの取引 (Transaction) を作成し、OrderID で注文にまとめる
+type Order struct {
+	ID              uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
+	BuyerID         uint64    `gorm:"not null;index" json:"buyer_id"`
+	SellerID        uint64    `gorm:"not null;index" json:"seller_id"`
+	Status          string    `gorm:"type:enum('PENDING','PURCHASED','SHIPPED','COMPLETED','CANCELED');default:'PENDING';not null" json:"status"`
+	ItemIDs         []uint64  `gorm:"type:json;serializer:json" json:"item_ids"`
+	Subtotal        int       `gorm:"not null" json:"subtotal"`     // 商品代金の合計
+	ShippingFee     int       `gorm:"not null" json:"shipping_fee"` // 出品者の送料ルールで計算した送料
+	Total           int       `gorm:"not null" json:"total"`
+	PaymentIntentID string    `gorm:"type:varchar(255);index" json:"-"`
 	CreatedAt       time.Time `json:"created_at"`
-	Status          string    `gorm:"type:enum('PURCHASED','SHIPPED','COMPLETED','CANCELED');default:'PURCHASED';not null" json:"status"`
+	UpdatedAt       time.Time `json:"updated_at"`
+
+	// 手続き開始時点の配送先。出品者のみ閲覧できるため JSON には含めない
+	ShippingAddress ShippingAddress `gorm:"embedded;embeddedPrefix:shipping_" json:"-"`
+
+	// Relations
+	Transactions []Transaction `gorm:"foreignKey:OrderID" json:"transactions,omitempty"`
+	Buyer        User          `gorm:"foreignKey:BuyerID" json:"buyer,omitempty"`
+	Seller       User          `gorm:"foreignKey:SellerID" json:"seller,omitempty"`
+}
+
+const (
+	OrderPending   = "PENDING" // 決済待ち (商品は RESERVED)
+	OrderPurchased = "PURCHASED"
+	OrderShipped   = "SHIPPED"
+	OrderCompleted = "COMPLETED"
+	OrderCanceled  = "CANCELED"
+)
+
+// Offer 値下げ交渉 (購入者が提示した価格に出品者が承諾・拒否・対案で応じる)
+// 承諾されると、購入期限まで提示した購入者だけがその価格で購入できる
+type Offer struct {
+	ID               uint64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	ItemID           uint64     `gorm:"not null;index" json:"item_id"`
+	BuyerID          uint64     `gorm:"not null;index" json:"buyer_id"`
+	SellerID         uint64     `gorm:"not null;index" json:"seller_id"`
+	Amount           int        `gorm:"not null" json:"amount"`           // 購入者が提示した価格
+	CounterAmount    *int       `json:"counter_amount,omitempty"`         // 出品者が対案として提示した価格
+	Message          string     `gorm:"type:varchar(255)" json:"message"` // 購入者からのひとこと
+	Status           string     `gorm:"type:enum('PENDING','ACCEPTED','COUNTERED','DECLINED','EXPIRED');default:'PENDING';not null;index" json:"status"`
+	ExpiresAt        time.Time  `gorm:"not null;index" json:"expires_at"` // 相手が応答する期限
+	AcceptedAt       *time.Time `json:"accepted_at,omitempty"`
+	PurchaseDeadline *time.Time `gorm:"index" json:"purchase_deadline,omitempty"` // 承諾された価格で購入できる期限
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
 
 	// Relations
 	Item  Item `gorm:"foreignKey:ItemID" json:"item,omitempty"`
 	Buyer User `gorm:"foreignKey:BuyerID" json:"buyer,omitempty"`
 }
 
+// 値下げ交渉の状態 (Offer.Status)
+const (
+	OfferPending   = "PENDING"   // 出品者の応答待ち
+	OfferCountered = "COUNTERED" // 出品者が対案を提示し、購入者の応答待ち
+	OfferAccepted  = "ACCEPTED"
+	OfferDeclined  = "DECLINED"
+	OfferExpired   = "EXPIRED"
+)
+
+// AgreedAmount 承諾された価格 (対案を承諾した場合は対案の価格)
+func (o Offer) AgreedAmount() int {
+	if o.CounterAmount != nil {
+		return *o.CounterAmount
+	}
+	return o.Amount
+}
+
+// 商品の販売形式 (Item.ListingType)
+const (
+	ListingFixed   = "FIXED"
+	ListingAuction = "AUCTION"
+)
+
+// Auction オークション (商品ごとに開催中のものは1つまで。落札されなかった場合は出品し直せる)
+type Auction struct {
+	ID              uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
+	ItemID          uint64    `gorm:"not null;index" json:"item_id"`
+	SellerID        uint64    `gorm:"not null;index" json:"seller_id"`
+	StartPrice      int       `gorm:"not null" json:"start_price"`
+	ReservePrice    *int      `json:"-"` // 最低落札価格。入札者には金額を公開せず、達しているかどうかのみ返す
+	CurrentPrice    int       `gorm:"not null" json:"current_price"`
+	HighestBidderID *uint64   `gorm:"index" json:"highest_bidder_id"`
+	BidCount        int       `gorm:"not null;default:0" json:"bid_count"`
+	EndsAt          time.Time `gorm:"not null;index" json:"ends_at"`    // 終了間際の入札で延長される
+	OriginalEndsAt  time.Time `gorm:"not null" json:"original_ends_at"` // 出品時に指定した終了日時
+	Status          string    `gorm:"type:enum('OPEN','SOLD','UNSOLD','CANCELED');default:'OPEN';not null;index" json:"status"`
+	TransactionID   *uint64   `json:"transaction_id,omitempty"` // 落札者との取引
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// オークションの状態 (Auction.Status)
+const (
+	AuctionOpen     = "OPEN"
+	AuctionSold     = "SOLD"   // 落札者との取引を作成済み
+	AuctionUnsold   = "UNSOLD" // 入札がないか、最低落札価格に達しなかった
+	AuctionCanceled = "CANCELED"
+)
+
+// ReserveMet 現在の最高入札額が最低落札価格に達しているか (最低落札価格がなければ入札があれば true)
+func (a Auction) ReserveMet() bool {
+	if a.BidCount == 0 {
+		return false
+	}
+	return a.ReservePrice == nil || a.CurrentPrice >= *a.ReservePrice
+}
+
+// Bid オークションへの入札
+type Bid struct {
+	ID        uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
+	AuctionID uint64    `gorm:"not null;index" json:"auction_id"`
+	BidderID  uint64    `gorm:"not null;index" json:"bidder_id"`
+	Amount    int       `gorm:"not null" json:"amount"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Relations
+	Bidder User `gorm:"foreignKey:BidderID" json:"bidder,omitempty"`
+}
+
+// ShippingRule 出品者ごとのまとめ買いの送料ルール (未設定の出品者は送料を加算しない)
+type ShippingRule struct {
+	ID                    uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
+	SellerID              uint64    `gorm:"not null;uniqueIndex" json:"seller_id"`
+	BaseFee               int       `gorm:"not null;default:0" json:"base_fee"`                // 1注文あたりの送料
+	PerItemFee            int       `gorm:"not null;default:0" json:"per_item_fee"`            // 2点目から1点ごとに加算する送料
+	FreeShippingThreshold int       `gorm:"not null;default:0" json:"free_shipping_threshold"` // 商品代金の合計がこの金額以上なら送料無料 (0 は無効)
+	MaxItems              int       `gorm:"not null;default:0" json:"max_items"`               // 1注文にまとめられる点数 (0 は既定の上限)
+	UpdatedAt             time.Time `json:"updated_at"`
+}
+
+// Fee 商品代金の合計と点数から送料を計算する
+func (r ShippingRule) Fee(subtotal, count int) int {
+	if count == 0 || (r.FreeShippingThreshold > 0 && subtotal >= r.FreeShippingThreshold) {
+		return 0
+	}
+	return r.BaseFee + r.PerItemFee*(count-1)
+}
+
+// ShippingAddress 取引に保存する配送先のスナップショット
+// 作成時のみ書き込み可能にし、購入後に住所録を変更・削除しても取引側は変わらない
+type ShippingAddress struct {
+	RecipientName string `gorm:"<-:create;type:text;serializer:encrypted" json:"recipient_name"`
+	PostalCode    string `gorm:"<-:create;type:varchar(8)" json:"postal_code"`
+	Prefecture    string `gorm:"<-:create;type:varchar(10)" json:"prefecture"`
+	City          string `gorm:"<-:create;type:varchar(100)" json:"city"`
+	Line1         string `gorm:"<-:create;type:text;serializer:encrypted" json:"line1"`
+	Line2         string `gorm:"<-:create;type:text;serializer:encrypted" json:"line2"`
+	Phone         string `gorm:"<-:create;type:text;serializer:encrypted" json:"phone"`
+}
+
+// Address 住所録 (1ユーザーにつき複数登録でき、1件を既定の配送先にできる)
+type Address struct {
+	ID            uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID        uint64    `gorm:"not null;index" json:"user_id"`
+	RecipientName string    `gorm:"type:text;serializer:encrypted" json:"recipient_name"`
+	PostalCode    string    `gorm:"type:varchar(8);not null" json:"postal_code"` // ハイフンなし7桁
+	Prefecture    string    `gorm:"type:varchar(10);not null" json:"prefecture"`
+	City          string    `gorm:"type:varchar(100);not null" json:"city"`
+	Line1         string    `gorm:"type:text;serializer:encrypted" json:"line1"` // 町名・番地
+	Line2         string    `gorm:"type:text;serializer:encrypted" json:"line2"` // 建物名・部屋番号
+	Phone         string    `gorm:"type:text;serializer:encrypted" json:"phone"`
+	IsDefault     bool      `gorm:"default:false;not null" json:"is_default"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Snapshot 取引に保存する配送先へ変換する
+func (a Address) Snapshot() ShippingAddress {
+	return ShippingAddress{
+		RecipientName: a.RecipientName,
+		PostalCode:    a.PostalCode,
+		Prefecture:    a.Prefecture,
+		City:          a.City,
+		Line1:         a.Line1,
+		Line2:         a.Line2,
+		Phone:         a.Phone,
+	}
+}
+
 // Like スワイプ履歴
 type Like struct {
 	ID        uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
 	UserID    uint64    `gorm:"not null;index" json:"user_id"`
 	ItemID    uint64    `gorm:"not null;index" json:"item_id"`
 	Reaction  string    `gorm:"type:enum('LIKE','NOPE');not null" json:"reaction"`
-	CreatedAt time.Time `json:"created_at"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
 }
 
 // Comment コメント
@@ -72,7 +463,7 @@ type Comment struct {
 	ItemID    uint64    `gorm:"not null;index" json:"item_id"`
 	UserID    uint64    `gorm:"not null" json:"user_id"`
 	Content   string    `gorm:"type:text;not null" json:"content"`
-	CreatedAt time.Time `json:"created_at"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
 
 	// Relations
 	User User `gorm:"foreignKey:UserID" json:"user,omitempty"`
@@ -112,6 +503,35 @@ type Category struct {
 	Children []Category `gorm:"foreignKey:ParentID" json:"children,omitempty"`
 }
 
+// CategoryAttribute カテゴリごとの商品属性の定義 (ブランド、サイズ、色、容量など)
+// 子カテゴリは親カテゴリの定義を引き継ぎ、同じ Name の定義があれば子カテゴリ側で上書きする
+type CategoryAttribute struct {
+	ID            uint     `gorm:"primaryKey;autoIncrement" json:"id"`
+	CategoryID    uint     `gorm:"not null;uniqueIndex:idx_category_attribute_name" json:"category_id"`
+	Name          string   `gorm:"type:varchar(50);not null;uniqueIndex:idx_category_attribute_name" json:"name"` // 属性のキー (例: size)
+	Label         string   `gorm:"type:varchar(50);not null" json:"label"`                                        // 表示名 (例: サイズ)
+	Type          string   `gorm:"type:enum('TEXT','NUMBER','ENUM');default:'TEXT';not null" json:"type"`
+	AllowedValues []string `gorm:"type:json;serializer:json" json:"allowed_values,omitempty"` // ENUM の選択肢
+	Unit          string   `gorm:"type:varchar(20)" json:"unit,omitempty"`                    // NUMBER の単位 (例: cm)
+	Required      bool     `gorm:"default:false;not null" json:"required"`                    // 出品 (ON_SALE) 時に必須
+	Position      int      `gorm:"not null;default:0" json:"position"`
+}
+
+const (
+	AttributeTypeText   = "TEXT"
+	AttributeTypeNumber = "NUMBER"
+	AttributeTypeEnum   = "ENUM"
+)
+
+// ItemAttribute 商品の属性値 (絞り込みに使うため1属性1行で保存する)
+type ItemAttribute struct {
+	ID          uint64   `gorm:"primaryKey;autoIncrement" json:"-"`
+	ItemID      uint64   `gorm:"not null;uniqueIndex:idx_item_attribute_name" json:"-"`
+	Name        string   `gorm:"type:varchar(50);not null;uniqueIndex:idx_item_attribute_name;index:idx_item_attribute_value,priority:1" json:"name"`
+	Value       string   `gorm:"type:varchar(255);not null;index:idx_item_attribute_value,priority:2" json:"value"`
+	NumberValue *float64 `json:"-"` // NUMBER 型の場合のみ。範囲での絞り込みに使う
+}
+
 // ProductCondition 商品の状態
 type ProductCondition struct {
 	ID   uint   `gorm:"primaryKey;autoIncrement" json:"id"`
@@ -122,11 +542,11 @@ type ProductCondition struct {
 // Review 取引評価テーブル
 type Review struct {
 	ID            uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
-	TransactionID uint64    `gorm:"not null;uniqueIndex" json:"transaction_id"`       // 取引IDと1対1
-	RaterID       uint64    `gorm:"not null" json:"rater_id"`                         // 評価したユーザーID (Buyer or Seller)
-	Rating        int       `gorm:"not null" json:"rating"`                           // 評価点 (1-5など)
-	Comment       string    `gorm:"type:text" json:"comment"`                         // 評価コメント
-	Role          string    `gorm:"type:enum('BUYER','SELLER');not null" json:"role"` // 評価者の役割
+	TransactionID uint64    `gorm:"not null;uniqueIndex:idx_review_tx_role,priority:1" json:"transaction_id"`                   // 取引ごとに購入者・出品者が1件ずつ
+	RaterID       uint64    `gorm:"not null" json:"rater_id"`                                                                   // 評価したユーザーID (Buyer or Seller)
+	Rating        int       `gorm:"not null" json:"rating"`                                                                     // 評価点 (1-5など)
+	Comment       string    `gorm:"type:text" json:"comment"`                                                                   // 評価コメント
+	Role          string    `gorm:"type:enum('BUYER','SELLER');not null;uniqueIndex:idx_review_tx_role,priority:2" json:"role"` // 評価者の役割
 	CreatedAt     time.Time `json:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at"`
 
@@ -161,8 +581,24 @@ type Follow struct {
 type ViewHistory struct {
 	ID        uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
 	UserID    uint64    `gorm:"not null;index" json:"user_id"`
-	ItemID    uint64    `gorm:"not null" json:"item_id"`
-	CreatedAt time.Time `json:"created_at"`
+	ItemID    uint64    `gorm:"not null;index:idx_view_item_created,priority:1" json:"item_id"`
+	CreatedAt time.Time `gorm:"index;index:idx_view_item_created,priority:2" json:"created_at"` // 日別集計と商品ごとのユニーク閲覧者数の集計に使う
+}
+
+// ItemDailyStat 商品ごと・日ごとの反応の集計 (閲覧履歴などから定期的に作り直す。出品者の分析画面で使う)
+type ItemDailyStat struct {
+	ID            uint64    `gorm:"primaryKey;autoIncrement" json:"-"`
+	ItemID        uint64    `gorm:"not null;uniqueIndex:idx_item_daily_stat,priority:1" json:"item_id"`
+	Date          time.Time `gorm:"type:date;not null;uniqueIndex:idx_item_daily_stat,priority:2;index:idx_seller_daily_stat,priority:2" json:"date"`
+	SellerID      uint64    `gorm:"not null;index:idx_seller_daily_stat,priority:1" json:"-"`
+	Views         int       `gorm:"not null;default:0" json:"views"`
+	UniqueViewers int       `gorm:"not null;default:0" json:"unique_viewers"` // その日の閲覧者数 (日をまたいだ合計には使えない)
+	Likes         int       `gorm:"not null;default:0" json:"likes"`
+	Nopes         int       `gorm:"not null;default:0" json:"nopes"`
+	Comments      int       `gorm:"not null;default:0" json:"comments"`
+	Purchases     int       `gorm:"not null;default:0" json:"purchases"` // 購入された数量 (キャンセル・支払い待ちを除く)
+	Revenue       int       `gorm:"not null;default:0" json:"revenue"`
+	UpdatedAt     time.Time `json:"-"`
 }
 
 // Message ダイレクトメッセージ
@@ -177,3 +613,78 @@ type Message struct {
 	Sender   User `gorm:"foreignKey:SenderID" json:"sender,omitempty"`
 	Receiver User `gorm:"foreignKey:ReceiverID" json:"receiver,omitempty"`
 }
+
+// Session ログインセッション (端末ごとのリフレッシュトークン)
+type Session struct {
+	ID                       uint64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID                   uint64     `gorm:"not null;index" json:"user_id"`
+	RefreshTokenHash         string     `gorm:"type:char(64);not null;uniqueIndex" json:"-"`
+	PreviousRefreshTokenHash string     `gorm:"type:char(64);index" json:"-"` // ローテーション前のトークン (再利用検知用)
+	UserAgent                string     `gorm:"type:varchar(255)" json:"user_agent"`
+	ExpiresAt                time.Time  `gorm:"not null" json:"expires_at"`
+	RevokedAt                *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt               time.Time  `json:"last_used_at"`
+	CreatedAt                time.Time  `json:"created_at"`
+}
+
+// UserIdentity ユーザーに紐づくログイン手段 (Firebase UID とプロバイダ)
+type UserIdentity struct {
+	ID          uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID      uint64    `gorm:"not null;index" json:"user_id"`
+	FirebaseUID string    `gorm:"size:255;uniqueIndex;not null" json:"-"`
+	Provider    string    `gorm:"type:varchar(50)" json:"provider"` // google.com, password など
+	Email       string    `gorm:"size:255" json:"email"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// AccountAuditLog アカウントの連携・統合などの監査ログ
+type AccountAuditLog struct {
+	ID        uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    uint64    `gorm:"not null;index" json:"user_id"` // 操作対象のユーザー
+	ActorID   uint64    `gorm:"not null" json:"actor_id"`      // 操作したユーザー
+	Action    string    `gorm:"type:varchar(50);not null" json:"action"`
+	Detail    string    `gorm:"type:text" json:"detail"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UserBlock ユーザー間のブロック・ミュート関係
+// BLOCK は双方向にやり取りを禁止し、MUTE は本人の画面・通知から相手を隠すだけ (相手には分からない)
+type UserBlock struct {
+	ID        uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    uint64    `gorm:"not null;index:idx_user_block,unique" json:"user_id"`         // ブロック・ミュートした側
+	TargetID  uint64    `gorm:"not null;index:idx_user_block,unique;index" json:"target_id"` // された側
+	Type      string    `gorm:"type:enum('BLOCK','MUTE');not null;index:idx_user_block,unique" json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Relations
+	Target User `gorm:"foreignKey:TargetID" json:"target,omitempty"`
+}
+
+// ブロック・ミュートの種類 (UserBlock.Type)
+const (
+	BlockTypeBlock = "BLOCK"
+	BlockTypeMute  = "MUTE"
+)
+
+// SellerVerification 出品者の本人確認申請
+// 書類は非公開バケットに保存し、オブジェクト名のみを記録する
+type SellerVerification struct {
+	ID              uint64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID          uint64     `gorm:"not null;index" json:"user_id"`
+	Status          string     `gorm:"type:enum('PENDING','APPROVED','REJECTED');default:'PENDING';not null;index" json:"status"`
+	DocumentType    string     `gorm:"type:varchar(50);not null" json:"document_type"` // DRIVERS_LICENSE, MY_NUMBER_CARD, PASSPORT など
+	LegalName       string     `gorm:"type:text;serializer:encrypted" json:"legal_name"`
+	DocumentObjects []string   `gorm:"type:json;serializer:json" json:"-"` // 非公開バケット内のオブジェクト名
+	ReviewerID      *uint64    `json:"reviewer_id,omitempty"`
+	RejectReason    string     `gorm:"type:text" json:"reject_reason,omitempty"`
+	ReviewedAt      *time.Time `json:"reviewed_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// 本人確認申請の状態 (SellerVerification.Status)
+const (
+	VerificationPending  = "PENDING"
+	VerificationApproved = "APPROVED"
+	VerificationRejected = "REJECTED"
+)
@@ -0,0 +1,31 @@
+package models
+
+import "testing"
+
+func TestShippingRuleFee(t *testing.T) {
+	rule := ShippingRule{BaseFee: 700, PerItemFee: 200, FreeShippingThreshold: 10000}
+	tests := []struct {
+		name     string
+		rule     ShippingRule
+		subtotal int
+		count    int
+		want     int
+	}{
+		{"no items", rule, 0, 0, 0},
+		{"single item pays base fee", rule, 3000, 1, 700},
+		{"additional items add per-item fee", rule, 3000, 3, 1100},
+		{"just below threshold", rule, 9999, 2, 900},
+		{"threshold reached is free", rule, 10000, 2, 0},
+		{"above threshold is free", rule, 25000, 5, 0},
+		{"zero threshold never free", ShippingRule{BaseFee: 500, PerItemFee: 100}, 1000000, 2, 600},
+		{"no rule adds nothing", ShippingRule{}, 5000, 4, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.Fee(tt.subtotal, tt.count); got != tt.want {
+				t.Errorf("Fee(%d, %d) = %d, want %d", tt.subtotal, tt.count, got, tt.want)
+			}
+		})
+	}
+}
@@ -2,45 +2,104 @@ package routes
 
 import (
 	"net/http"
-	"strconv"
 
 	"github.com/Kousuke-irie/hackathon-backend/database"
+	"github.com/Kousuke-irie/hackathon-backend/firebase"
 	"github.com/Kousuke-irie/hackathon-backend/handlers"
+	"github.com/Kousuke-irie/hackathon-backend/middleware"
 	"github.com/Kousuke-irie/hackathon-backend/models"
 	"github.com/gin-gonic/gin"
 )
 
 func SetupRoutes(r *gin.Engine) {
+	// 公開API: ログイン不要。トークンが付いていれば閲覧者として扱う
+	public := r.Group("", middleware.OptionalAuth())
+	// 認証必須API: Authorization: Bearer <アクセストークン> を検証し、呼び出し元をコンテキストから取得する
+	authed := r.Group("", middleware.AuthRequired())
+
 	// 認証
 	r.POST("/login", handlers.LoginHandler)
-	r.PUT("/users/me", handlers.UpdateUserHandler)
-	r.GET("/users/:id", handlers.GetUserByIDHandler)
-
-	r.POST("/users/:id/follow", handlers.ToggleFollowHandler)
-	r.GET("/users/:id/follows", handlers.GetFollowsHandler)
-	r.GET("/users/:id/is-following", handlers.CheckFollowingHandler)
-	r.GET("/users/:id/reviews", handlers.GetUserReviewsHandler)
+	if _, ok := firebase.Local(); ok {
+		// オフライン開発用: ローカル検証器でのみIDトークンを発行できる
+		r.POST("/dev/id-token", handlers.IssueDevIDTokenHandler)
+	}
+	r.POST("/auth/refresh", handlers.RefreshSessionHandler)
+	authed.POST("/auth/logout", handlers.LogoutHandler)
+	authed.POST("/auth/logout-all", handlers.LogoutAllHandler) // 全端末からログアウト
+	authed.GET("/auth/sessions", handlers.GetSessionsHandler)
+	authed.DELETE("/auth/sessions/:id", handlers.RevokeSessionHandler)
+	authed.PUT("/users/me", handlers.UpdateUserHandler)
+	authed.DELETE("/users/me", handlers.DeleteAccountHandler)         // 退会
+	authed.GET("/users/me/export", handlers.ExportAccountDataHandler) // 個人データのエクスポート
+	authed.GET("/users/me/identities", handlers.GetIdentitiesHandler)
+	authed.POST("/users/me/identities", handlers.LinkIdentityHandler)
+	authed.DELETE("/users/me/identities/:id", handlers.UnlinkIdentityHandler)
+	authed.POST("/users/me/merge", handlers.MergeAccountHandler) // 自分の別アカウントを統合
+	authed.GET("/users/me/privacy", handlers.GetPrivacySettingsHandler)
+	authed.PUT("/users/me/privacy", handlers.UpdatePrivacySettingsHandler) // 公開範囲設定
+	authed.GET("/users/me/addresses", handlers.GetAddressesHandler)        // 住所録
+	authed.POST("/users/me/addresses", handlers.CreateAddressHandler)
+	authed.PUT("/users/me/addresses/:id", handlers.UpdateAddressHandler)
+	authed.PUT("/users/me/addresses/:id/default", handlers.SetDefaultAddressHandler)
+	authed.DELETE("/users/me/addresses/:id", handlers.DeleteAddressHandler)
+	authed.GET("/users/me/verification", handlers.GetMyVerificationHandler) // 出品者の本人確認
+	authed.POST("/users/me/verification", handlers.SubmitVerificationHandler)
+	authed.POST("/users/me/verification/upload-url", handlers.GetVerificationUploadUrlHandler)
+	authed.GET("/users/me/shipping-rule", handlers.GetMyShippingRuleHandler) // まとめ買いの送料ルール
+	authed.PUT("/users/me/shipping-rule", handlers.UpdateShippingRuleHandler)
+	public.GET("/users/:id", handlers.GetUserByIDHandler)
+	public.GET("/users/:id/shipping-rule", handlers.GetUserShippingRuleHandler)
+
+	authed.POST("/users/:id/follow", handlers.ToggleFollowHandler)
+	authed.POST("/users/:id/block", handlers.BlockUserHandler)
+	authed.DELETE("/users/:id/block", handlers.UnblockUserHandler)
+	authed.POST("/users/:id/mute", handlers.MuteUserHandler)
+	authed.DELETE("/users/:id/mute", handlers.UnmuteUserHandler)
+	public.GET("/users/:id/follows", handlers.GetFollowsHandler)
+	public.GET("/users/:id/is-following", handlers.CheckFollowingHandler)
+	public.GET("/users/:id/reviews", handlers.GetUserReviewsHandler)
+	public.GET("/users/:id/likes", handlers.GetUserLikesHandler)
 
 	// 商品
-	items := r.Group("/items")
+	items := public.Group("/items")
 	{
-		items.POST("", handlers.CreateItemHandler)
 		items.GET("", handlers.GetItemListHandler)
 		items.GET("/:id", handlers.GetItemDetailHandler)
-		items.PUT("/:id", handlers.UpdateItemHandler)
-		items.POST("/analyze", handlers.AnalyzeItemHandler)
-		items.POST("/upload-url", handlers.GetGcsUploadUrlHandler)
 		items.GET("/:id/comments", handlers.GetCommentsHandler)
-		items.POST("/:id/comments", handlers.PostCommentHandler)
-		items.POST("/:id/sold", handlers.CompletePurchaseAndCreateTransactionHandler)
+		items.GET("/:id/price-history", handlers.GetPriceHistoryHandler)
+		items.GET("/:id/auction", handlers.GetAuctionHandler)
 		items.GET("/by-ids", handlers.GetItemsByIdsHandler)
 		items.GET("/:id/liked", handlers.CheckItemLikedHandler)
 		items.POST("/:id/view", handlers.RecordViewHandler)
-		items.POST("/generate-message", handlers.GenerateAIChatMessageHandler)
+	}
+	authedItems := authed.Group("/items")
+	{
+		authedItems.POST("", handlers.CreateItemHandler)
+		authedItems.PUT("/:id", handlers.UpdateItemHandler)
+		authedItems.DELETE("/:id", handlers.DeleteItemHandler)
+		authedItems.POST("/:id/pause", handlers.PauseItemHandler)
+		authedItems.POST("/:id/resume", handlers.ResumeItemHandler)
+		authedItems.POST("/:id/archive", handlers.ArchiveItemHandler)
+		authedItems.PUT("/:id/schedule", handlers.ScheduleItemHandler)
+		authedItems.DELETE("/:id/schedule", handlers.UnscheduleItemHandler)
+		authedItems.GET("/:id/revisions", handlers.GetItemRevisionsHandler)
+		authedItems.GET("/:id/revisions/diff", handlers.GetItemRevisionDiffHandler)
+		authedItems.POST("/import", handlers.ImportItemsHandler)
+		authedItems.POST("/analyze", handlers.AnalyzeItemHandler)
+		authedItems.POST("/upload-url", handlers.GetGcsUploadUrlHandler)
+		authedItems.POST("/:id/comments", handlers.PostCommentHandler)
+		authedItems.POST("/:id/sold", handlers.CompletePurchaseAndCreateTransactionHandler)
+		authedItems.GET("/:id/offers", handlers.GetItemOffersHandler)
+		authedItems.POST("/:id/offers", handlers.MakeOfferHandler)     // 値下げ交渉
+		authedItems.POST("/:id/auction", handlers.StartAuctionHandler) // オークション形式で出品
+		authedItems.DELETE("/:id/auction", handlers.CancelAuctionHandler)
+		authedItems.POST("/:id/bids", handlers.PlaceBidHandler)
+		authedItems.GET("/:id/stats", handlers.GetItemStatsHandler) // 出品者向けの反応の集計 (?days=)
+		authedItems.POST("/generate-message", handlers.GenerateAIChatMessageHandler)
 	}
 
 	// 自分の出品
-	my := r.Group("/my")
+	my := authed.Group("/my")
 	{
 		my.GET("/items", handlers.GetMyItemsHandler)
 		my.GET("/likes", handlers.GetLikedItemsHandler)
@@ -52,30 +111,38 @@ func SetupRoutes(r *gin.Engine) {
 		my.GET("/following-items", handlers.GetFollowingItemsHandler)
 		my.GET("/recommend-users", handlers.GetRecommendedUsersHandler)
 		my.GET("/category-recommendations", handlers.GetCategoryRecommendationsHandler)
+		my.GET("/blocks", handlers.GetMyBlocksHandler)       // ブロック・ミュート中のユーザー
+		my.GET("/orders", handlers.GetMyOrdersHandler)       // まとめ買いの注文 (?role=buyer|seller)
+		my.GET("/offers", handlers.GetMyOffersHandler)       // 値下げ交渉 (?role=buyer|seller)
+		my.GET("/analytics", handlers.GetMyAnalyticsHandler) // ショップ全体の反応の集計 (?days=)
 	}
 
 	// スワイプ
-	swipe := r.Group("/swipe")
+	swipe := authed.Group("/swipe")
 	{
 		swipe.GET("/items", handlers.GetSwipeItemsHandler)
 		swipe.POST("/action", handlers.RecordSwipeHandler)
 	}
 
 	// 決済
-	r.POST("/payment/create-payment-intent", handlers.CreatePaymentIntentHandler)
+	authed.POST("/payment/create-payment-intent", handlers.CreatePaymentIntentHandler)
+	authed.POST("/payment/cancel", handlers.CancelCheckoutHandler) // 購入手続きの中止 (商品の確保を解除)
 
 	// コミュニティ
-	comm := r.Group("/communities")
+	comm := public.Group("/communities")
 	{
 		comm.GET("", handlers.GetCommunitiesHandler)
-		comm.POST("", handlers.CreateCommunityHandler)
-		comm.PUT("/:id", handlers.UpdateCommunityHandler)
-		comm.DELETE("/:id", handlers.DeleteCommunityHandler)
 		comm.GET("/:id/posts", handlers.GetCommunityPostsHandler)
-		comm.POST("/:id/posts", handlers.PostToCommunityHandler)
+	}
+	authedComm := authed.Group("/communities")
+	{
+		authedComm.POST("", handlers.CreateCommunityHandler)
+		authedComm.PUT("/:id", handlers.UpdateCommunityHandler)
+		authedComm.DELETE("/:id", handlers.DeleteCommunityHandler)
+		authedComm.POST("/:id/posts", handlers.PostToCommunityHandler)
 	}
 
-	chats := r.Group("/chats")
+	chats := authed.Group("/chats")
 	{
 		chats.GET("/threads", handlers.GetChatThreadsHandler) // スレッド一覧
 		chats.GET("/:userId", handlers.GetChatHistoryHandler) // 特定相手との履歴
@@ -83,42 +150,63 @@ func SetupRoutes(r *gin.Engine) {
 	}
 
 	// ▼▼▼ メタデータ関連 API ▼▼▼
-	r.GET("/meta/categories", handlers.GetCategoriesHandler)
-	r.GET("/meta/conditions", handlers.GetConditionsHandler)
-	r.GET("/meta/categories/tree", handlers.GetCategoryTreeHandler)
-	r.POST("/meta/ai-chat", handlers.AIChatConciergeHandler)
+	public.GET("/meta/categories", handlers.GetCategoriesHandler)
+	public.GET("/meta/conditions", handlers.GetConditionsHandler)
+	public.GET("/meta/categories/tree", handlers.GetCategoryTreeHandler)
+	public.GET("/meta/categories/:id/attributes", handlers.GetCategoryAttributesHandler)
+	public.POST("/meta/ai-chat", handlers.AIChatConciergeHandler)
 
 	// ▼▼▼  取引関連 API ▼▼▼
-	tx := r.Group("/transactions")
+	tx := authed.Group("/transactions")
 	{
 		tx.GET("/:tx_id", handlers.GetTransactionDetailHandler)
 		tx.PUT("/:tx_id/status", handlers.UpdateTransactionStatusHandler) // ステータス更新
 		tx.POST("/:tx_id/review", handlers.PostReviewHandler)             // 評価投稿
 		tx.POST("/:tx_id/cancel", handlers.CancelTransactionHandler)
+		tx.POST("/:tx_id/payment-intent", handlers.CreateAuctionPaymentIntentHandler) // 落札代金の支払い
+		tx.POST("/:tx_id/confirm-payment", handlers.ConfirmAuctionPaymentHandler)
 	}
 
-	// WebSocket エンドポイント
-	r.GET("/ws/notifications", handlers.WSNotificationHandler)
+	// ▼▼▼  まとめ買い (注文) API ▼▼▼
+	orders := authed.Group("/orders")
+	{
+		orders.POST("", handlers.CreateOrderHandler) // 手続きの開始 (商品をすべて確保して決済インテントを作成)
+		orders.GET("/:id", handlers.GetOrderDetailHandler)
+		orders.POST("/:id/complete", handlers.CompleteOrderHandler)
+		orders.PUT("/:id/status", handlers.UpdateOrderStatusHandler)
+		orders.POST("/:id/cancel", handlers.CancelOrderHandler)
+	}
 
-	// 通知一覧取得 API (NotificationsPage用)
-	r.GET("/my/notifications", func(c *gin.Context) {
-		// 1. ヘッダーから ID を取得
-		userIDStr := c.GetHeader("X-User-ID")
-		if userIDStr == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "X-User-ID header is required"})
-			return
-		}
+	// ▼▼▼  値下げ交渉 API ▼▼▼
+	offers := authed.Group("/offers")
+	{
+		offers.POST("/:id/counter", handlers.CounterOfferHandler) // 出品者の対案
+		offers.POST("/:id/accept", handlers.AcceptOfferHandler)
+		offers.POST("/:id/decline", handlers.DeclineOfferHandler)
+	}
 
-		// 2. 文字列を uint64 に変換。エラーがあれば即座に 400 を返す
-		userID, err := strconv.ParseUint(userIDStr, 10, 64)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid User ID format in header"})
-			return
-		}
+	// ▼▼▼ 管理・モデレーション API (MODERATOR / ADMIN のみ) ▼▼▼
+	admin := authed.Group("/admin", middleware.RequirePermission(middleware.PermAccessAdmin))
+	{
+		admin.GET("/users", middleware.RequirePermission(middleware.PermManageUsers), handlers.GetAdminUsersHandler)
+		admin.PUT("/users/:id/role", middleware.RequirePermission(middleware.PermManageUsers), handlers.UpdateUserRoleHandler)
+		admin.DELETE("/comments/:id", middleware.RequirePermission(middleware.PermModerateContent), handlers.DeleteCommentByModeratorHandler)
+		admin.DELETE("/community-posts/:id", middleware.RequirePermission(middleware.PermModerateContent), handlers.DeleteCommunityPostByModeratorHandler)
+		admin.GET("/verifications", middleware.RequirePermission(middleware.PermReviewVerifications), handlers.GetVerificationsHandler)
+		admin.PUT("/verifications/:id", middleware.RequirePermission(middleware.PermReviewVerifications), handlers.ReviewVerificationHandler)
+	}
+
+	// WebSocket エンドポイント (ブラウザはヘッダーを付けられないため ?token= で認証)
+	authed.GET("/ws/notifications", handlers.WSNotificationHandler)
+
+	// 通知一覧取得 API (NotificationsPage用)
+	authed.GET("/my/notifications", func(c *gin.Context) {
+		// 1. 認証済みユーザーの ID を取得
+		userID := middleware.CurrentUserID(c)
 
 		var notifications []models.Notification
 
-		// 3. データベース検索
+		// 2. データベース検索
 		// 💡 修正ポイント: クエリを分割して確実に取得し、Order の指定を文字列で明示する
 		db := database.DBClient
 		if err := db.Where("user_id = ?", userID).Order("id DESC").Find(&notifications).Error; err != nil {
@@ -130,7 +218,7 @@ func SetupRoutes(r *gin.Engine) {
 			return
 		}
 
-		// 4. 結果が null の場合は明示的に空配列にする (フロントエンドの .map でのエラー防止)
+		// 3. 結果が null の場合は明示的に空配列にする (フロントエンドの .map でのエラー防止)
 		if notifications == nil {
 			notifications = []models.Notification{}
 		}
@@ -0,0 +1,101 @@
+package session
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// AccessTokenTTL アクセストークンの有効期間 (短命にして漏洩時の影響を抑える)
+	AccessTokenTTL = 15 * time.Minute
+	// RefreshTokenTTL リフレッシュトークンの有効期間 (リフレッシュのたびに延長される)
+	RefreshTokenTTL = 30 * 24 * time.Hour
+
+	issuer          = "hackathon-backend"
+	defaultLocalKey = "local-session-key"
+)
+
+var signingKey []byte
+
+// Claims アクセストークンのクレーム
+type Claims struct {
+	UserID    uint64 `json:"uid"`
+	SessionID uint64 `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// Init アクセストークンの署名鍵を SESSION_SIGNING_KEY から読み込む
+// AUTH_PROVIDER=local の場合のみ、未設定でも開発用の鍵で起動できる
+func Init() error {
+	key := os.Getenv("SESSION_SIGNING_KEY")
+	if key == "" {
+		if strings.ToLower(os.Getenv("AUTH_PROVIDER")) != "local" {
+			return errors.New("SESSION_SIGNING_KEY is not set")
+		}
+		log.Println("WARNING: SESSION_SIGNING_KEY is not set. Using the built-in development key.")
+		key = defaultLocalKey
+	}
+	signingKey = []byte(key)
+	return nil
+}
+
+// IssueAccessToken セッションに紐づくアクセストークンを発行する
+func IssueAccessToken(userID, sessionID uint64) (string, error) {
+	now := time.Now()
+	claims := Claims{
+		UserID:    userID,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   fmt.Sprintf("%d", userID),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL)),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(signingKey)
+}
+
+// ParseAccessToken 署名と有効期限を検証してクレームを返す
+// セッションが失効していないかの確認は呼び出し側でDBを参照して行う
+func ParseAccessToken(tokenStr string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return signingKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !claims.VerifyIssuer(issuer, true) || claims.UserID == 0 || claims.SessionID == 0 {
+		return nil, errors.New("invalid access token claims")
+	}
+	return claims, nil
+}
+
+// NewRefreshToken ランダムなリフレッシュトークンと、DB保存用のハッシュを生成する
+func NewRefreshToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	return token, HashRefreshToken(token), nil
+}
+
+// HashRefreshToken リフレッシュトークンのハッシュ (DBには平文を保存しない)
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}